@@ -37,7 +37,9 @@ var (
 )
 
 func addKnownTypes(scheme *runtime.Scheme) error {
-	scheme.AddKnownTypes(GroupVersion, &Migration{}, &MigrationList{})
+	scheme.AddKnownTypes(GroupVersion, &Migration{}, &MigrationList{}, &MigrationRun{}, &MigrationRunList{},
+		&SchemaRequirement{}, &SchemaRequirementList{}, &NotificationPolicy{}, &NotificationPolicyList{},
+		&ClusterNotificationPolicy{}, &ClusterNotificationPolicyList{})
 	metav1.AddToGroupVersion(scheme, GroupVersion)
 	return nil
 }
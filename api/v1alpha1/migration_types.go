@@ -19,25 +19,295 @@ package v1alpha1
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 const (
 	Prefix     = "flyway-operator.davidkarlsen.com"
 	Generation = Prefix + "/" + "generation"
-	paused     = Prefix + "/" + "paused"
+	TargetName = Prefix + "/" + "target"
+	// Paused set to true on a migration stops it from creating jobs
+	Paused = Prefix + "/" + "paused"
+	// Action requests a one-shot action, like repair, when annotated on a migration,
+	// and labels the jobs with what they run
+	Action = Prefix + "/" + "action"
+	// ConfirmClean must be set to the current generation of a migration to run the clean command
+	ConfirmClean = Prefix + "/" + "confirm-clean"
+	// Approve must be set to the hash of the pending migrations to apply them, when approval is required
+	Approve = Prefix + "/" + "approve"
+	// WaitFor on a pod names the migration, as name or namespace/name, its containers wait for before they start.
+	// The pod is also labeled with this key, with any value, for the webhook to be called for it.
+	WaitFor = Prefix + "/" + "wait-for"
+	// WaitForVersion on a pod is the lowest schema version its containers wait for, along with WaitFor
+	WaitForVersion = Prefix + "/" + "wait-for-version"
+
+	cleanCommand = "clean"
+
+	// DefaultTarget is the name of the target when a single database is migrated
+	DefaultTarget = "default"
+
+	// ConditionReady is true when the migration has been applied to all databases at the current generation
+	ConditionReady = "Ready"
+	// ConditionPendingApproval is true while pending migrations wait for approval
+	ConditionPendingApproval = "PendingApproval"
+	// ConditionDrifted is true when a database no longer matches the migrations which were applied to it
+	ConditionDrifted = "Drifted"
+	// ConditionDependenciesReady is true when the migrations this migration depends on are ready
+	ConditionDependenciesReady = "DependenciesReady"
+	// ConditionWaitingForLock is true while a database is locked by the job of another migration
+	ConditionWaitingForLock = "WaitingForLock"
+	// ConditionPaused is true while the migration is paused, and no jobs are created
+	ConditionPaused = "Paused"
+	// ConditionReconciling is true while the migration has yet to be applied, as kstatus expects
+	ConditionReconciling = "Reconciling"
+	// ConditionStalled is true when the migration failed, or cannot be reconciled, as kstatus expects
+	ConditionStalled = "Stalled"
+)
+
+// TargetPhase is the state of the migration of a single database
+// +kubebuilder:validation:Enum=Pending;Running;Succeeded;Failed
+type TargetPhase string
+
+const (
+	TargetPending   TargetPhase = "Pending"
+	TargetRunning   TargetPhase = "Running"
+	TargetSucceeded TargetPhase = "Succeeded"
+	TargetFailed    TargetPhase = "Failed"
 )
 
 // MigrationStatus defines the observed state of Migration
 type MigrationStatus struct {
+	// The generation of the migration the status was last reconciled for
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	// +patchMergeKey=type
 	// +patchStrategy=merge
 	// +listType=map
 	// +listMapKey=type
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// The state of the migration per database
+	// +listType=map
+	// +listMapKey=name
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// The most recent runs, newest last
+	// +kubebuilder:validation:Optional
+	History []HistoryEntry `json:"history,omitempty"`
+
+	// The version the databases are migrated to, the target of the flyway configuration
+	// +kubebuilder:validation:Optional
+	RequestedVersion string `json:"requestedVersion,omitempty"`
+
+	// The lowest schema version reached by the databases
+	// +kubebuilder:validation:Optional
+	CurrentVersion string `json:"currentVersion,omitempty"`
+
+	// The pending migrations awaiting approval
+	// +kubebuilder:validation:Optional
+	Approval *ApprovalStatus `json:"approval,omitempty"`
+
+	// When the drift check was last started
+	// +kubebuilder:validation:Optional
+	LastDriftCheckTime *metav1.Time `json:"lastDriftCheckTime,omitempty"`
+
+	// When the migration waiting for its schedule or a maintenance window is planned to run
+	// +kubebuilder:validation:Optional
+	NextScheduledRun *metav1.Time `json:"nextScheduledRun,omitempty"`
+
+	// The workloads scaled down while the migration is applied
+	// +kubebuilder:validation:Optional
+	ScaledDownWorkloads []WorkloadReference `json:"scaledDownWorkloads,omitempty"`
+
+	// The number of migrations pending on all databases after their last successful run
+	// +kubebuilder:validation:Optional
+	PendingCount int32 `json:"pendingCount,omitempty"`
+
+	// When the most recent run completed
+	// +kubebuilder:validation:Optional
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+
+	// The image of the migrations last applied, by digest when it is known
+	// +kubebuilder:validation:Optional
+	Source string `json:"source,omitempty"`
+
+	// A one-line description of the state of the migration, for dashboards
+	// +kubebuilder:validation:Optional
+	Summary string `json:"summary,omitempty"`
+
+	// The notifications receivers failed to receive, which are sent again, oldest first
+	// +kubebuilder:validation:Optional
+	UndeliveredNotifications []UndeliveredNotification `json:"undeliveredNotifications,omitempty"`
+
+	// the secrets matching the database selector which do not describe a database
+	// +kubebuilder:validation:Optional
+	InvalidDatabases []InvalidDatabase `json:"invalidDatabases,omitempty"`
+}
+
+// ApprovalStatus identifies the pending migrations of all databases, found for a generation of the migration
+type ApprovalStatus struct {
+	// the generation of the migration the pending migrations were found for
+	Generation int64 `json:"generation"`
+
+	// hash of the pending migrations of all databases and of the image they were found in, empty when nothing is pending
+	// +kubebuilder:validation:Optional
+	Hash string `json:"hash,omitempty"`
+
+	// the databases the pending migrations were found for, databases found later are checked and approved anew
+	// +kubebuilder:validation:Optional
+	Targets []string `json:"targets,omitempty"`
+
+	// the image the pending migrations were found in, by digest when known, the approved migrations are applied from it
+	// +kubebuilder:validation:Optional
+	Source string `json:"source,omitempty"`
+}
+
+// HistoryEntry records the outcome of a run against a database
+type HistoryEntry struct {
+	// what was run, like migrate or rollback
+	Action string `json:"action"`
+
+	// name of the database
+	Target string `json:"target"`
+
+	// name of the job which did the run
+	JobName string `json:"jobName"`
+
+	// uid of the job which did the run
+	JobUID types.UID `json:"jobUID"`
+
+	// the generation of the migration which was run
+	Generation int64 `json:"generation,omitempty"`
+
+	// the outcome of the run, Succeeded or Failed
+	Result TargetPhase `json:"result"`
+
+	// details about the outcome
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// InvalidDatabase is a secret matching the database selector which does not describe a database
+type InvalidDatabase struct {
+	// name of the secret
+	Secret string `json:"secret"`
+
+	// the resource version of the secret which was found invalid
+	// +kubebuilder:validation:Optional
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	// why the secret does not describe a database
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// UndeliveredNotification is a notification of a transition of the migration which a receiver failed to receive
+type UndeliveredNotification struct {
+	// the notification policy of the receiver, namespace/name for namespaced policies,
+	// all policies notifying of the transition when not set
+	// +kubebuilder:validation:Optional
+	Policy string `json:"policy,omitempty"`
+
+	// name of the receiver in the policy
+	// +kubebuilder:validation:Optional
+	Receiver string `json:"receiver,omitempty"`
+
+	// the transition notified of
+	Event NotificationEvent `json:"event"`
+
+	// what was run, like migrate or rollback
+	Action string `json:"action"`
+
+	// the generation of the migration which was run
+	Generation int64 `json:"generation,omitempty"`
+
+	// name of the database the job failed on
+	// +kubebuilder:validation:Optional
+	Target string `json:"target,omitempty"`
+
+	// why the job failed
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	RequestedVersion string `json:"requestedVersion,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	CurrentVersion string `json:"currentVersion,omitempty"`
+
+	// when the transition happened
+	Time metav1.Time `json:"time"`
+
+	// how often sending the notification failed
+	Attempts int32 `json:"attempts"`
+
+	// why sending the notification last failed
+	// +kubebuilder:validation:Optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// TargetStatus is the observed state of the migration of a single database
+type TargetStatus struct {
+	// name of the target
+	Name string `json:"name"`
+
+	// name of the job migrating the target
+	JobName string `json:"jobName"`
+
+	// the generation of the migration the job was run for
+	Generation int64 `json:"generation,omitempty"`
+
+	// the state of the migration of the target
+	Phase TargetPhase `json:"phase"`
+
+	// details about the state
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// the schema version of the database after the last successful run
+	// +kubebuilder:validation:Optional
+	CurrentVersion string `json:"currentVersion,omitempty"`
+
+	// the scripts which were pending after the last successful run
+	// +kubebuilder:validation:Optional
+	PendingMigrations []string `json:"pendingMigrations,omitempty"`
+
+	// name of the ConfigMap holding the preview of the last dry-run
+	// +kubebuilder:validation:Optional
+	DryRunConfigMap string `json:"dryRunConfigMap,omitempty"`
+
+	// the drift found by the last drift check
+	// +kubebuilder:validation:Optional
+	Drift []string `json:"drift,omitempty"`
+
+	// the generation of the migration flyway clean was run at, clean is not run again for the database at that generation
+	// +kubebuilder:validation:Optional
+	CleanedGeneration int64 `json:"cleanedGeneration,omitempty"`
+
+	// the uid of the job whose outcome was recorded last, per action, it is not recorded again
+	// +kubebuilder:validation:Optional
+	RecordedJobs map[string]types.UID `json:"recordedJobs,omitempty"`
+
+	// the applied versions above the target version of the rollback, newest first, which the Scripts strategy undoes
+	// +kubebuilder:validation:Optional
+	UndoVersions []string `json:"undoVersions,omitempty"`
+
+	// the generation of the migration info reported the versions to undo for
+	// +kubebuilder:validation:Optional
+	UndoGeneration int64 `json:"undoGeneration,omitempty"`
 }
 
 func (m *Migration) GetConditions() []metav1.Condition {
@@ -50,17 +320,73 @@ func (m *Migration) SetConditions(conditions []metav1.Condition) {
 
 func (m *Migration) IsPaused() bool {
 	filtered := lo.PickBy(m.Annotations, func(key, value string) bool {
-		return key == paused && value == strconv.FormatBool(true)
+		return key == Paused && value == strconv.FormatBool(true)
 	})
 	return len(filtered) > 0
 }
 
+// IsReady returns true if the migration has been applied at its current generation
+func (m *Migration) IsReady() bool {
+	condition := meta.FindStatusCondition(m.Status.Conditions, ConditionReady)
+	return condition != nil && condition.Status == metav1.ConditionTrue && condition.ObservedGeneration == m.Generation
+}
+
+// HasReachedVersion returns true if all databases of the migration have reached the schema version
+func (m *Migration) HasReachedVersion(version string) bool {
+	return m.Status.CurrentVersion != "" && CompareVersions(m.Status.CurrentVersion, version) >= 0
+}
+
+// IsApproved returns true if the pending migrations may be applied, either because approval is not required,
+// or the pending migrations found for the current generation have been approved
+func (m *Migration) IsApproved() bool {
+	if m.Spec.Approval == nil || !m.Spec.Approval.Required {
+		return true
+	}
+	approval := m.Status.Approval
+	if approval == nil || approval.Generation != m.Generation {
+		return false
+	}
+
+	return approval.Hash == "" || m.Annotations[Approve] == approval.Hash
+}
+
+// HasCleanCommand returns true if the migration runs flyway clean, which drops all objects in the schemas
+func (m *Migration) HasCleanCommand() bool {
+	return lo.ContainsBy(m.Spec.FlywayConfiguration.Commands, func(command string) bool {
+		return strings.EqualFold(command, cleanCommand)
+	})
+}
+
+// IsCleanConfirmed returns true if running clean has been confirmed for the current generation
+func (m *Migration) IsCleanConfirmed() bool {
+	return m.Annotations[ConfirmClean] == m.GenerationAsString()
+}
+
+// GetRequestedVersion returns the version the databases are migrated to
+func (m *Migration) GetRequestedVersion() string {
+	if m.Spec.Rollback != nil {
+		return m.Spec.Rollback.TargetVersion
+	}
+	if m.Spec.FlywayConfiguration.Target != nil {
+		return *m.Spec.FlywayConfiguration.Target
+	}
+
+	return "latest"
+}
+
 func (m *Migration) GenerationAsString() string {
 	return strconv.Itoa(int(m.Generation))
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Current",type=string,JSONPath=`.status.currentVersion`
+//+kubebuilder:printcolumn:name="Pending",type=integer,JSONPath=`.status.pendingCount`
+//+kubebuilder:printcolumn:name="Last Run",type=date,JSONPath=`.status.lastRunTime`
+//+kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.status.source`
+//+kubebuilder:printcolumn:name="Summary",type=string,JSONPath=`.status.summary`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Migration is the Schema for the migrations API
 type Migration struct {
@@ -73,14 +399,73 @@ type Migration struct {
 }
 
 // MigrationSpec defines the desired state of Migration
+// +kubebuilder:validation:XValidation:rule="[has(self.database), has(self.databases), has(self.databaseSelector)].filter(x, x).size() == 1",message="exactly one of database, databases and databaseSelector must be set"
+// +kubebuilder:validation:XValidation:rule="!(has(self.schedule) && has(self.maintenanceWindows))",message="schedule and maintenanceWindows are mutually exclusive"
 type MigrationSpec struct {
 	// settings for database connection
-	// +kubebuilder:validation:Required
-	Database Database `json:"database"`
+	// +kubebuilder:validation:Optional
+	Database *Database `json:"database,omitempty"`
+
+	// Multiple databases to apply the migration to, one job is run per database.
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=name
+	Databases []DatabaseTarget `json:"databases,omitempty"`
+
+	// Discover the databases to apply the migration to, one job is run per database.
+	// +kubebuilder:validation:Optional
+	DatabaseSelector *DatabaseSelector `json:"databaseSelector,omitempty"`
+
+	// The maximum number of databases to migrate concurrently when using databases or databaseSelector.
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrency int32 `json:"maxConcurrency,omitempty"`
 
 	// settings for flyway
 	FlywayConfiguration FlywayConfiguration `json:"flywayConfiguration"`
 
+	// Roll back the databases to a previous version.
+	// While set, the rollback is run instead of the flyway commands.
+	// +kubebuilder:validation:Optional
+	Rollback *Rollback `json:"rollback,omitempty"`
+
+	// Preview the migration instead of applying it, also while the migration is paused.
+	// The pending migrations, and the SQL flyway would run when a Flyway Teams license is configured,
+	// are stored in a ConfigMap referenced from the status of each database.
+	// +kubebuilder:validation:Optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Require the pending migrations to be approved before they are applied
+	// +kubebuilder:validation:Optional
+	Approval *Approval `json:"approval,omitempty"`
+
+	// Periodically check the databases for changes made outside of the migrations
+	// +kubebuilder:validation:Optional
+	DriftCheck *DriftCheck `json:"driftCheck,omitempty"`
+
+	// Migrations which must be ready at their current generation before this migration is applied,
+	// like the migration of a shared schema.
+	// +kubebuilder:validation:Optional
+	DependsOn []MigrationReference `json:"dependsOn,omitempty"`
+
+	// Workloads in the namespace of the migration which are scaled down while the migration is applied,
+	// and scaled back up once it is ready, so that they do not run against a schema being changed.
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=kind
+	// +listMapKey=name
+	WorkloadRefs []WorkloadReference `json:"workloadRefs,omitempty"`
+
+	// Apply changes of the migration at the next time of this cron schedule, like "0 2 * * *", instead of right away.
+	// Prefix with CRON_TZ=<zone> to use another time zone than UTC.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule,omitempty"`
+
+	// Only apply changes of the migration while one of these windows is open.
+	// +kubebuilder:validation:Optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
 	// settings defining the SQL migrations
 	// +kubebuilder:validation:Required
 	MigrationSource MigrationSource `json:"migrationSource"`
@@ -102,13 +487,71 @@ type Database struct {
 	JdbcUrl string `json:"jdbcUrl"`
 }
 
-func (r *Migration) GetCredentials() v1.SecretReference {
+// DatabaseTarget is one of multiple databases to apply the migration to
+type DatabaseTarget struct {
+	// Name of the target, used in the name of the migration job for the database.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	Database `json:",inline"`
+
+	// Flyway placeholders for this database, these take precedence over the placeholders of the migration source.
+	// +kubebuilder:validation:Optional
+	Placeholders map[string]string `json:"placeholders,omitempty"`
+}
+
+// DatabaseSelector discovers databases from secrets holding their connection settings.
+// The name of the secret is used as the name of the database.
+type DatabaseSelector struct {
+	// Selects the secrets in the namespace of the migration.
+	// +kubebuilder:validation:Required
+	SecretSelector metav1.LabelSelector `json:"secretSelector"`
+
+	// The key in the secrets holding the jdbcUrl.
+	// +kubebuilder:default="jdbcUrl"
+	JdbcUrlKey string `json:"jdbcUrlKey,omitempty"`
+
+	// The key in the secrets holding the username.
+	// +kubebuilder:default="username"
+	UsernameKey string `json:"usernameKey,omitempty"`
+
+	// The key in the secrets holding the password.
+	// +kubebuilder:default="password"
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// GetTargets returns the databases to migrate, discovered databases are not included
+func (m *Migration) GetTargets() []DatabaseTarget {
+	if m.Spec.Database != nil {
+		return []DatabaseTarget{
+			{
+				Name:     DefaultTarget,
+				Database: *m.Spec.Database,
+			},
+		}
+	}
+
+	return m.Spec.Databases
+}
+
+// GetCredentials returns the secret of the credentials of the single database of the migration, empty when the
+// migration has multiple databases.
+//
+// Deprecated: use GetTargets, each database of the migration has its own credentials.
+func (m *Migration) GetCredentials() v1.SecretReference {
+	if m.Spec.Database == nil {
+		return v1.SecretReference{}
+	}
+
 	return v1.SecretReference{
-		Name:      r.Spec.Database.Credentials.Name,
-		Namespace: r.Namespace,
+		Name:      m.Spec.Database.Credentials.Name,
+		Namespace: m.Namespace,
 	}
 }
 
+// +kubebuilder:validation:XValidation:rule="!(has(self.target) && has(self.cherryPick))",message="target and cherryPick are mutually exclusive"
 type FlywayConfiguration struct {
 	// Reference to the flyway image to use.
 	// +kubebuilder:validation:Optional
@@ -119,6 +562,11 @@ type FlywayConfiguration struct {
 	// +kubebuilder:default={"info", "migrate", "info"}
 	Commands []string `json:"commands"`
 
+	// Allow the clean command, which drops all objects in the schemas.
+	// Clean is only run when the annotation flyway-operator.davidkarlsen.com/confirm-clean is set to the current generation.
+	// +kubebuilder:validation:Optional
+	AllowClean bool `json:"allowClean,omitempty"`
+
 	// The default flyway schema to use.
 	// See https://documentation.red-gate.com/fd/default-schema-184127496.html
 	// +kubebuilder:validation:Optional
@@ -129,6 +577,102 @@ type FlywayConfiguration struct {
 	// +kubebuilder:validation:Optional
 	BaselineOnMigrate *bool `json:"baselineOnMigrate"`
 
+	// The schemas managed by flyway.
+	// See https://documentation.red-gate.com/fd/schemas-184127488.html
+	// +kubebuilder:validation:Optional
+	Schemas []string `json:"schemas,omitempty"`
+
+	// The name of flyway's schema history table.
+	// See https://documentation.red-gate.com/fd/table-184127507.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinLength=1
+	Table *string `json:"table,omitempty"`
+
+	// The target version up to which flyway should consider migrations.
+	// See https://documentation.red-gate.com/fd/target-184127509.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^(latest|current|next|\d+(\.\d+)*)$`
+	Target *string `json:"target,omitempty"`
+
+	// Only apply these migrations, given by their version, or the description of repeatable migrations.
+	// Requires Flyway Teams, see https://documentation.red-gate.com/fd/cherry-pick-184127466.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:items:MinLength=1
+	// +kubebuilder:validation:items:Pattern=`^[^,]+$`
+	CherryPick []string `json:"cherryPick,omitempty"`
+
+	// Allow migrations to be run out of order.
+	// See https://documentation.red-gate.com/fd/out-of-order-184127470.html
+	// +kubebuilder:validation:Optional
+	OutOfOrder *bool `json:"outOfOrder,omitempty"`
+
+	// Whether to automatically call validate when running migrate.
+	// See https://documentation.red-gate.com/fd/validate-on-migrate-184127512.html
+	// +kubebuilder:validation:Optional
+	ValidateOnMigrate *bool `json:"validateOnMigrate,omitempty"`
+
+	// Whether to disable clean.
+	// See https://documentation.red-gate.com/fd/clean-disabled-184127447.html
+	// +kubebuilder:validation:Optional
+	CleanDisabled *bool `json:"cleanDisabled,omitempty"`
+
+	// The version to tag an existing schema with when executing baseline.
+	// See https://documentation.red-gate.com/fd/baseline-version-184127456.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^\d+(\.\d+)*$`
+	BaselineVersion *string `json:"baselineVersion,omitempty"`
+
+	// The maximum number of retries when attempting to connect to the database.
+	// See https://documentation.red-gate.com/fd/connect-retries-184127448.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	ConnectRetries *int32 `json:"connectRetries,omitempty"`
+
+	// The maximum number of retries when trying to obtain a lock, -1 retries indefinitely.
+	// See https://documentation.red-gate.com/fd/lock-retry-count-184127465.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=-1
+	LockRetryCount *int32 `json:"lockRetryCount,omitempty"`
+
+	// Whether to allow mixing transactional and non-transactional statements within the same migration.
+	// See https://documentation.red-gate.com/fd/mixed-184127467.html
+	// +kubebuilder:validation:Optional
+	Mixed *bool `json:"mixed,omitempty"`
+
+	// Whether to group all pending migrations together in the same transaction when applying them.
+	// See https://documentation.red-gate.com/fd/group-184127459.html
+	// +kubebuilder:validation:Optional
+	Group *bool `json:"group,omitempty"`
+
+	// The username that will be recorded in the schema history table as having applied the migration.
+	// See https://documentation.red-gate.com/fd/installed-by-184127462.html
+	// +kubebuilder:validation:Optional
+	InstalledBy *string `json:"installedBy,omitempty"`
+
+	// Locations to scan for migrations, replaces the default location of the migration source.
+	// Include filesystem:/flyway/sql to keep the SQLs from the migration source.
+	// See https://documentation.red-gate.com/fd/locations-184127466.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:items:Pattern=`^(filesystem|classpath|s3|gcs):.+`
+	Locations []string `json:"locations,omitempty"`
+
+	// The file name prefix for versioned SQL migrations.
+	// See https://documentation.red-gate.com/fd/sql-migration-prefix-184127504.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinLength=1
+	SqlMigrationPrefix *string `json:"sqlMigrationPrefix,omitempty"`
+
+	// The file name prefix for undo SQL migrations, used by rollbacks with the Undo and Scripts strategies.
+	// See https://documentation.red-gate.com/fd/undo-sql-migration-prefix-184127580.html
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinLength=1
+	UndoSqlMigrationPrefix *string `json:"undoSqlMigrationPrefix,omitempty"`
+
+	// Fully qualified class names of callbacks to use to hook into the flyway lifecycle.
+	// See https://documentation.red-gate.com/fd/callbacks-184127440.html
+	// +kubebuilder:validation:Optional
+	Callbacks []string `json:"callbacks,omitempty"`
+
 	// Arbitrary entries to set as env-vars to Flyway migration job.
 	// +kubebuilder:validation:Optional
 	EnvVars []v1.EnvVar `json:"envVars"`
@@ -147,6 +691,92 @@ type FlywayConfiguration struct {
 	VolumeMounts []v1.VolumeMount `json:"volumeMounts,omitempty"`
 }
 
+// Approval defines the approval of pending migrations
+type Approval struct {
+	// Only apply pending migrations after they have been approved. The pending migrations are found by running info,
+	// and are approved by annotating the migration with the hash of them, which is reported in the status.
+	// +kubebuilder:validation:Optional
+	Required bool `json:"required,omitempty"`
+}
+
+// DriftCheck defines a periodic check of the databases against the migrations, which runs validate and info.
+// Checksum mismatches, applied migrations missing from or unknown to the migration source,
+// and failed migrations are reported as drift.
+type DriftCheck struct {
+	// When to check, in cron format, like "0 * * * *" for every hour
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+}
+
+// MigrationReference refers to another migration
+type MigrationReference struct {
+	// name of the migration
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// namespace of the migration, defaults to the namespace of the referring migration
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// GetNamespacedName returns the name of the referenced migration, resolved against the namespace of the referring one
+func (r MigrationReference) GetNamespacedName(namespace string) types.NamespacedName {
+	return types.NamespacedName{Namespace: lo.CoalesceOrEmpty(r.Namespace, namespace), Name: r.Name}
+}
+
+// WorkloadReference refers to a workload in the namespace of the migration
+type WorkloadReference struct {
+	// kind of the workload
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=Deployment;StatefulSet
+	Kind string `json:"kind"`
+
+	// name of the workload
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// MaintenanceWindow is a recurring period in which the databases may be changed
+type MaintenanceWindow struct {
+	// When the window opens, in cron format, like "0 22 * * 1-5" for weekday evenings.
+	// Prefix with CRON_TZ=<zone> to use another time zone than UTC.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// How long the window stays open, like "4h"
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+}
+
+// RollbackStrategy defines how migrations are undone
+// +kubebuilder:validation:Enum=Undo;Scripts
+type RollbackStrategy string
+
+const (
+	// RollbackUndo runs flyway undo, which requires Flyway Teams
+	RollbackUndo RollbackStrategy = "Undo"
+	// RollbackScripts runs the undo-scripts (U__) of the migration source in reverse order, and removes
+	// the undone versions from the schema history table
+	RollbackScripts RollbackStrategy = "Scripts"
+)
+
+// Rollback defines a rollback to a previous version
+type Rollback struct {
+	// The version to roll back to, all migrations above it are undone.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^\d+(\.\d+)*$`
+	TargetVersion string `json:"targetVersion"`
+
+	// How to undo the migrations, Undo requires Flyway Teams, Scripts works with the community edition.
+	// See https://documentation.red-gate.com/fd/undo-184127627.html
+	// +kubebuilder:default=Undo
+	Strategy RollbackStrategy `json:"strategy,omitempty"`
+}
+
 // MigrationSource defines the source for the flyway-migrations.
 type MigrationSource struct {
 
@@ -167,11 +797,15 @@ type MigrationSource struct {
 	Encoding string `json:"encoding"`
 
 	// Flyway placeholders, see: https://documentation.red-gate.com/fd/placeholders-configuration-184127475.html
-	// These will be injected as env-vars with the required prefix.
+	// These are rendered into the flyway configuration file of the migration job.
 	// +kubebuilder:validation:Optional
 	Placeholders map[string]string `json:"placeholders"`
 }
 
+// GetPlaceholdersAsEnvVars returns the placeholders as the env-vars flyway reads them from.
+//
+// Deprecated: the placeholders are rendered into the flyway configuration file of the migration job, and are no
+// longer passed as env-vars.
 func (r *MigrationSource) GetPlaceholdersAsEnvVars() []v1.EnvVar {
 	return lo.MapToSlice(r.Placeholders, func(key string, value string) v1.EnvVar {
 		return v1.EnvVar{
@@ -189,4 +823,3 @@ type MigrationList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []Migration `json:"items"`
 }
-
@@ -0,0 +1,105 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RunCommand is a flyway command which may be run ad-hoc
+// +kubebuilder:validation:Enum=info;validate;baseline;repair
+type RunCommand string
+
+// MigrationRunSpec defines the commands to run against the databases of a migration
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable, create a new run instead"
+type MigrationRunSpec struct {
+	// The migration to take the connection, migration source and pod settings from, in the same namespace
+	// +kubebuilder:validation:Required
+	MigrationRef v1.LocalObjectReference `json:"migrationRef"`
+
+	// The flyway commands to run, see https://documentation.red-gate.com/fd/commands-184127446.html
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Commands []RunCommand `json:"commands"`
+
+	// Name of the database of the migration to run against, all databases when not set
+	// +kubebuilder:validation:Optional
+	Target string `json:"target,omitempty"`
+}
+
+// MigrationRunStatus defines the observed state of MigrationRun
+type MigrationRunStatus struct {
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// the state of the run, Succeeded when the commands succeeded against all databases
+	// +kubebuilder:validation:Optional
+	Phase TargetPhase `json:"phase,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// The state of the run per database
+	// +listType=map
+	// +listMapKey=name
+	Targets []TargetStatus `json:"targets,omitempty"`
+}
+
+func (m *MigrationRun) GetConditions() []metav1.Condition {
+	return m.Status.Conditions
+}
+
+func (m *MigrationRun) SetConditions(conditions []metav1.Condition) {
+	m.Status.Conditions = conditions
+}
+
+// IsFinished returns true once the run has succeeded or failed, runs are never repeated
+func (m *MigrationRun) IsFinished() bool {
+	return m.Status.Phase == TargetSucceeded || m.Status.Phase == TargetFailed
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Migration",type=string,JSONPath=`.spec.migrationRef.name`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MigrationRun runs ad-hoc flyway commands against the databases of a migration
+type MigrationRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Spec   MigrationRunSpec   `json:"spec,omitempty"`
+	Status MigrationRunStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MigrationRunList contains a list of MigrationRun
+type MigrationRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MigrationRun `json:"items"`
+}
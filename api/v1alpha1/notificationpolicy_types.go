@@ -0,0 +1,136 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NotificationEvent is a transition of a migration which is notified of
+// +kubebuilder:validation:Enum=Succeeded;Failed
+type NotificationEvent string
+
+const (
+	// NotificationSucceeded is sent when the migration, or its rollback, has been applied to all databases
+	NotificationSucceeded NotificationEvent = "Succeeded"
+	// NotificationFailed is sent when a job migrating, or rolling back, a database has failed
+	NotificationFailed NotificationEvent = "Failed"
+)
+
+// ReceiverType is the kind of service a notification is sent to
+// +kubebuilder:validation:Enum=Slack;Teams;Webhook
+type ReceiverType string
+
+const (
+	// ReceiverSlack posts to a Slack incoming webhook
+	ReceiverSlack ReceiverType = "Slack"
+	// ReceiverTeams posts an adaptive card to a Microsoft Teams workflow webhook
+	ReceiverTeams ReceiverType = "Teams"
+	// ReceiverWebhook posts the notification as JSON
+	ReceiverWebhook ReceiverType = "Webhook"
+)
+
+// Receiver is a webhook notifications are posted to
+type Receiver struct {
+	// Name of the receiver, for reference in events
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Required
+	Type ReceiverType `json:"type"`
+
+	// The key of the secret holding the URL of the webhook, as it grants posting to it.
+	// The secret is in the namespace of the policy, or of the operator for a ClusterNotificationPolicy.
+	// +kubebuilder:validation:Required
+	URLSecretRef v1.SecretKeySelector `json:"urlSecretRef"`
+}
+
+// NotificationPolicySpec defines which transitions of which migrations are notified to which receivers
+type NotificationPolicySpec struct {
+	// Selects the migrations notified of by their labels, all migrations when not set
+	// +kubebuilder:validation:Optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// The transitions notified of, all when not set
+	// +kubebuilder:validation:Optional
+	Events []NotificationEvent `json:"events,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	Receivers []Receiver `json:"receivers"`
+}
+
+// ClusterNotificationPolicySpec defines which transitions of the migrations of which namespaces are notified
+type ClusterNotificationPolicySpec struct {
+	NotificationPolicySpec `json:",inline"`
+
+	// Selects the namespaces of the migrations by their labels, all namespaces when not set
+	// +kubebuilder:validation:Optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// IsNotified returns true if the policy notifies of the event
+func (s *NotificationPolicySpec) IsNotified(event NotificationEvent) bool {
+	return len(s.Events) == 0 || lo.Contains(s.Events, event)
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// NotificationPolicy notifies of the transitions of the migrations in its namespace
+type NotificationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Spec NotificationPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NotificationPolicyList contains a list of NotificationPolicy
+type NotificationPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NotificationPolicy `json:"items"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterNotificationPolicy notifies of the transitions of the migrations in all namespaces
+type ClusterNotificationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Spec ClusterNotificationPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterNotificationPolicyList contains a list of ClusterNotificationPolicy
+type ClusterNotificationPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterNotificationPolicy `json:"items"`
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionRequirementMet is true when the databases of the migration have reached the required schema version
+const ConditionRequirementMet = "Met"
+
+// SchemaRequirementSpec declares the schema version an application requires
+type SchemaRequirementSpec struct {
+	// The migration managing the schema, the namespace defaults to the namespace of the requirement
+	// +kubebuilder:validation:Required
+	MigrationRef MigrationReference `json:"migrationRef"`
+
+	// The lowest schema version the application requires
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^\d+(\.\d+)*$`
+	MinVersion string `json:"minVersion"`
+
+	// Selects the pods of the application in the namespace of the requirement.
+	// When the pod webhook is enabled, these are not created while the requirement is not met.
+	// +kubebuilder:validation:Optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// SchemaRequirementStatus defines the observed state of SchemaRequirement
+type SchemaRequirementStatus struct {
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// The lowest schema version reached by the databases of the migration
+	// +kubebuilder:validation:Optional
+	CurrentVersion string `json:"currentVersion,omitempty"`
+}
+
+func (m *SchemaRequirement) GetConditions() []metav1.Condition {
+	return m.Status.Conditions
+}
+
+func (m *SchemaRequirement) SetConditions(conditions []metav1.Condition) {
+	m.Status.Conditions = conditions
+}
+
+// IsMet returns true if the requirement was last found to be met
+func (m *SchemaRequirement) IsMet() bool {
+	return meta.IsStatusConditionTrue(m.Status.Conditions, ConditionRequirementMet)
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Migration",type=string,JSONPath=`.spec.migrationRef.name`
+//+kubebuilder:printcolumn:name="Required",type=string,JSONPath=`.spec.minVersion`
+//+kubebuilder:printcolumn:name="Current",type=string,JSONPath=`.status.currentVersion`
+//+kubebuilder:printcolumn:name="Met",type=string,JSONPath=`.status.conditions[?(@.type=="Met")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SchemaRequirement declares that an application requires the schema managed by a migration to be at a minimum version
+type SchemaRequirement struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Spec   SchemaRequirementSpec   `json:"spec,omitempty"`
+	Status SchemaRequirementStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SchemaRequirementList contains a list of SchemaRequirement
+type SchemaRequirementList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SchemaRequirement `json:"items"`
+}
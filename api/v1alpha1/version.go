@@ -0,0 +1,67 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"math/big"
+	"strings"
+)
+
+// CompareVersions compares two flyway versions like 1.2.3, returning -1, 0 or 1.
+// Parts are compared numerically, missing parts count as 0, so 1.2 equals 1.2.0.
+func CompareVersions(a, b string) int {
+	partsA, partsB := splitVersion(a), splitVersion(b)
+	for i := range max(len(partsA), len(partsB)) {
+		if c := versionPart(partsA, i).Cmp(versionPart(partsB, i)); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func splitVersion(version string) []string {
+	return strings.FieldsFunc(version, func(r rune) bool { return r == '.' || r == '_' })
+}
+
+func versionPart(parts []string, i int) *big.Int {
+	part := new(big.Int)
+	if i < len(parts) {
+		// non-numeric parts are not valid flyway versions, and count as 0
+		if _, ok := part.SetString(parts[i], 10); !ok {
+			part.SetInt64(0)
+		}
+	}
+
+	return part
+}
+
+// MinVersion returns the lowest of the versions
+func MinVersion(versions ...string) string {
+	if len(versions) == 0 {
+		return ""
+	}
+
+	lowest := versions[0]
+	for _, version := range versions[1:] {
+		if CompareVersions(version, lowest) < 0 {
+			lowest = version
+		}
+	}
+
+	return lowest
+}
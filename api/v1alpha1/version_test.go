@@ -0,0 +1,17 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/testhelper"
+)
+
+func TestCompareVersions(t *testing.T) {
+	testhelper.AssertEquals(t, 0, CompareVersions("1.2", "1.2.0"))
+	testhelper.AssertEquals(t, 0, CompareVersions("1_2", "1.2"))
+	testhelper.AssertEquals(t, -1, CompareVersions("1.2", "1.10"))
+	testhelper.AssertEquals(t, 1, CompareVersions("2", "1.99.99"))
+	testhelper.AssertEquals(t, 1, CompareVersions("20240101120000", "9"))
+	testhelper.AssertEquals(t, "1.10", MinVersion("2", "1.10", "1.11"))
+	testhelper.AssertEquals(t, "", MinVersion())
+}
@@ -24,8 +24,123 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Approval) DeepCopyInto(out *Approval) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Approval.
+func (in *Approval) DeepCopy() *Approval {
+	if in == nil {
+		return nil
+	}
+	out := new(Approval)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApprovalStatus) DeepCopyInto(out *ApprovalStatus) {
+	*out = *in
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalStatus.
+func (in *ApprovalStatus) DeepCopy() *ApprovalStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNotificationPolicy) DeepCopyInto(out *ClusterNotificationPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNotificationPolicy.
+func (in *ClusterNotificationPolicy) DeepCopy() *ClusterNotificationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNotificationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterNotificationPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNotificationPolicyList) DeepCopyInto(out *ClusterNotificationPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterNotificationPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNotificationPolicyList.
+func (in *ClusterNotificationPolicyList) DeepCopy() *ClusterNotificationPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNotificationPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterNotificationPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNotificationPolicySpec) DeepCopyInto(out *ClusterNotificationPolicySpec) {
+	*out = *in
+	in.NotificationPolicySpec.DeepCopyInto(&out.NotificationPolicySpec)
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNotificationPolicySpec.
+func (in *ClusterNotificationPolicySpec) DeepCopy() *ClusterNotificationPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNotificationPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Database) DeepCopyInto(out *Database) {
 	*out = *in
@@ -42,6 +157,60 @@ func (in *Database) DeepCopy() *Database {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseSelector) DeepCopyInto(out *DatabaseSelector) {
+	*out = *in
+	in.SecretSelector.DeepCopyInto(&out.SecretSelector)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseSelector.
+func (in *DatabaseSelector) DeepCopy() *DatabaseSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseTarget) DeepCopyInto(out *DatabaseTarget) {
+	*out = *in
+	in.Database.DeepCopyInto(&out.Database)
+	if in.Placeholders != nil {
+		in, out := &in.Placeholders, &out.Placeholders
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseTarget.
+func (in *DatabaseTarget) DeepCopy() *DatabaseTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftCheck) DeepCopyInto(out *DriftCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftCheck.
+func (in *DriftCheck) DeepCopy() *DriftCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FlywayConfiguration) DeepCopyInto(out *FlywayConfiguration) {
 	*out = *in
@@ -60,6 +229,91 @@ func (in *FlywayConfiguration) DeepCopyInto(out *FlywayConfiguration) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.Schemas != nil {
+		in, out := &in.Schemas, &out.Schemas
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Table != nil {
+		in, out := &in.Table, &out.Table
+		*out = new(string)
+		**out = **in
+	}
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(string)
+		**out = **in
+	}
+	if in.CherryPick != nil {
+		in, out := &in.CherryPick, &out.CherryPick
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OutOfOrder != nil {
+		in, out := &in.OutOfOrder, &out.OutOfOrder
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ValidateOnMigrate != nil {
+		in, out := &in.ValidateOnMigrate, &out.ValidateOnMigrate
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CleanDisabled != nil {
+		in, out := &in.CleanDisabled, &out.CleanDisabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.BaselineVersion != nil {
+		in, out := &in.BaselineVersion, &out.BaselineVersion
+		*out = new(string)
+		**out = **in
+	}
+	if in.ConnectRetries != nil {
+		in, out := &in.ConnectRetries, &out.ConnectRetries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.LockRetryCount != nil {
+		in, out := &in.LockRetryCount, &out.LockRetryCount
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Mixed != nil {
+		in, out := &in.Mixed, &out.Mixed
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Group != nil {
+		in, out := &in.Group, &out.Group
+		*out = new(bool)
+		**out = **in
+	}
+	if in.InstalledBy != nil {
+		in, out := &in.InstalledBy, &out.InstalledBy
+		*out = new(string)
+		**out = **in
+	}
+	if in.Locations != nil {
+		in, out := &in.Locations, &out.Locations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SqlMigrationPrefix != nil {
+		in, out := &in.SqlMigrationPrefix, &out.SqlMigrationPrefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.UndoSqlMigrationPrefix != nil {
+		in, out := &in.UndoSqlMigrationPrefix, &out.UndoSqlMigrationPrefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.Callbacks != nil {
+		in, out := &in.Callbacks, &out.Callbacks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.EnvVars != nil {
 		in, out := &in.EnvVars, &out.EnvVars
 		*out = make([]corev1.EnvVar, len(*in))
@@ -100,6 +354,60 @@ func (in *FlywayConfiguration) DeepCopy() *FlywayConfiguration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HistoryEntry) DeepCopyInto(out *HistoryEntry) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HistoryEntry.
+func (in *HistoryEntry) DeepCopy() *HistoryEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(HistoryEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InvalidDatabase) DeepCopyInto(out *InvalidDatabase) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InvalidDatabase.
+func (in *InvalidDatabase) DeepCopy() *InvalidDatabase {
+	if in == nil {
+		return nil
+	}
+	out := new(InvalidDatabase)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Migration) DeepCopyInto(out *Migration) {
 	*out = *in
@@ -160,68 +468,585 @@ func (in *MigrationList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MigrationSource) DeepCopyInto(out *MigrationSource) {
+func (in *MigrationReference) DeepCopyInto(out *MigrationReference) {
 	*out = *in
-	if in.ImagePullSecrets != nil {
-		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
-		*out = make([]corev1.LocalObjectReference, len(*in))
-		copy(*out, *in)
-	}
-	if in.Placeholders != nil {
-		in, out := &in.Placeholders, &out.Placeholders
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationSource.
-func (in *MigrationSource) DeepCopy() *MigrationSource {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationReference.
+func (in *MigrationReference) DeepCopy() *MigrationReference {
 	if in == nil {
 		return nil
 	}
-	out := new(MigrationSource)
+	out := new(MigrationReference)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MigrationSpec) DeepCopyInto(out *MigrationSpec) {
+func (in *MigrationRun) DeepCopyInto(out *MigrationRun) {
 	*out = *in
-	in.Database.DeepCopyInto(&out.Database)
-	in.FlywayConfiguration.DeepCopyInto(&out.FlywayConfiguration)
-	in.MigrationSource.DeepCopyInto(&out.MigrationSource)
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationSpec.
-func (in *MigrationSpec) DeepCopy() *MigrationSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationRun.
+func (in *MigrationRun) DeepCopy() *MigrationRun {
 	if in == nil {
 		return nil
 	}
-	out := new(MigrationSpec)
+	out := new(MigrationRun)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MigrationRun) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MigrationStatus) DeepCopyInto(out *MigrationStatus) {
+func (in *MigrationRunList) DeepCopyInto(out *MigrationRunList) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]v1.Condition, len(*in))
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MigrationRun, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationStatus.
-func (in *MigrationStatus) DeepCopy() *MigrationStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationRunList.
+func (in *MigrationRunList) DeepCopy() *MigrationRunList {
 	if in == nil {
 		return nil
 	}
-	out := new(MigrationStatus)
+	out := new(MigrationRunList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MigrationRunList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MigrationRunSpec) DeepCopyInto(out *MigrationRunSpec) {
+	*out = *in
+	out.MigrationRef = in.MigrationRef
+	if in.Commands != nil {
+		in, out := &in.Commands, &out.Commands
+		*out = make([]RunCommand, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationRunSpec.
+func (in *MigrationRunSpec) DeepCopy() *MigrationRunSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationRunSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MigrationRunStatus) DeepCopyInto(out *MigrationRunStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]TargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationRunStatus.
+func (in *MigrationRunStatus) DeepCopy() *MigrationRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MigrationSource) DeepCopyInto(out *MigrationSource) {
+	*out = *in
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Placeholders != nil {
+		in, out := &in.Placeholders, &out.Placeholders
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationSource.
+func (in *MigrationSource) DeepCopy() *MigrationSource {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MigrationSpec) DeepCopyInto(out *MigrationSpec) {
+	*out = *in
+	if in.Database != nil {
+		in, out := &in.Database, &out.Database
+		*out = new(Database)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Databases != nil {
+		in, out := &in.Databases, &out.Databases
+		*out = make([]DatabaseTarget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DatabaseSelector != nil {
+		in, out := &in.DatabaseSelector, &out.DatabaseSelector
+		*out = new(DatabaseSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.FlywayConfiguration.DeepCopyInto(&out.FlywayConfiguration)
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		*out = new(Rollback)
+		**out = **in
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(Approval)
+		**out = **in
+	}
+	if in.DriftCheck != nil {
+		in, out := &in.DriftCheck, &out.DriftCheck
+		*out = new(DriftCheck)
+		**out = **in
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]MigrationReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.WorkloadRefs != nil {
+		in, out := &in.WorkloadRefs, &out.WorkloadRefs
+		*out = make([]WorkloadReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
+	in.MigrationSource.DeepCopyInto(&out.MigrationSource)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationSpec.
+func (in *MigrationSpec) DeepCopy() *MigrationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MigrationStatus) DeepCopyInto(out *MigrationStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]TargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]HistoryEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(ApprovalStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastDriftCheckTime != nil {
+		in, out := &in.LastDriftCheckTime, &out.LastDriftCheckTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextScheduledRun != nil {
+		in, out := &in.NextScheduledRun, &out.NextScheduledRun
+		*out = (*in).DeepCopy()
+	}
+	if in.ScaledDownWorkloads != nil {
+		in, out := &in.ScaledDownWorkloads, &out.ScaledDownWorkloads
+		*out = make([]WorkloadReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastRunTime != nil {
+		in, out := &in.LastRunTime, &out.LastRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.UndeliveredNotifications != nil {
+		in, out := &in.UndeliveredNotifications, &out.UndeliveredNotifications
+		*out = make([]UndeliveredNotification, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InvalidDatabases != nil {
+		in, out := &in.InvalidDatabases, &out.InvalidDatabases
+		*out = make([]InvalidDatabase, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationStatus.
+func (in *MigrationStatus) DeepCopy() *MigrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotificationPolicy) DeepCopyInto(out *NotificationPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotificationPolicy.
+func (in *NotificationPolicy) DeepCopy() *NotificationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NotificationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NotificationPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotificationPolicyList) DeepCopyInto(out *NotificationPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NotificationPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotificationPolicyList.
+func (in *NotificationPolicyList) DeepCopy() *NotificationPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(NotificationPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NotificationPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotificationPolicySpec) DeepCopyInto(out *NotificationPolicySpec) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]NotificationEvent, len(*in))
+		copy(*out, *in)
+	}
+	if in.Receivers != nil {
+		in, out := &in.Receivers, &out.Receivers
+		*out = make([]Receiver, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotificationPolicySpec.
+func (in *NotificationPolicySpec) DeepCopy() *NotificationPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NotificationPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Receiver) DeepCopyInto(out *Receiver) {
+	*out = *in
+	in.URLSecretRef.DeepCopyInto(&out.URLSecretRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Receiver.
+func (in *Receiver) DeepCopy() *Receiver {
+	if in == nil {
+		return nil
+	}
+	out := new(Receiver)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Rollback) DeepCopyInto(out *Rollback) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Rollback.
+func (in *Rollback) DeepCopy() *Rollback {
+	if in == nil {
+		return nil
+	}
+	out := new(Rollback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaRequirement) DeepCopyInto(out *SchemaRequirement) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaRequirement.
+func (in *SchemaRequirement) DeepCopy() *SchemaRequirement {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaRequirement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SchemaRequirement) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaRequirementList) DeepCopyInto(out *SchemaRequirementList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SchemaRequirement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaRequirementList.
+func (in *SchemaRequirementList) DeepCopy() *SchemaRequirementList {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaRequirementList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SchemaRequirementList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaRequirementSpec) DeepCopyInto(out *SchemaRequirementSpec) {
+	*out = *in
+	out.MigrationRef = in.MigrationRef
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaRequirementSpec.
+func (in *SchemaRequirementSpec) DeepCopy() *SchemaRequirementSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaRequirementSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaRequirementStatus) DeepCopyInto(out *SchemaRequirementStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaRequirementStatus.
+func (in *SchemaRequirementStatus) DeepCopy() *SchemaRequirementStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaRequirementStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetStatus) DeepCopyInto(out *TargetStatus) {
+	*out = *in
+	if in.PendingMigrations != nil {
+		in, out := &in.PendingMigrations, &out.PendingMigrations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RecordedJobs != nil {
+		in, out := &in.RecordedJobs, &out.RecordedJobs
+		*out = make(map[string]types.UID, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.UndoVersions != nil {
+		in, out := &in.UndoVersions, &out.UndoVersions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetStatus.
+func (in *TargetStatus) DeepCopy() *TargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UndeliveredNotification) DeepCopyInto(out *UndeliveredNotification) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UndeliveredNotification.
+func (in *UndeliveredNotification) DeepCopy() *UndeliveredNotification {
+	if in == nil {
+		return nil
+	}
+	out := new(UndeliveredNotification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadReference) DeepCopyInto(out *WorkloadReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadReference.
+func (in *WorkloadReference) DeepCopy() *WorkloadReference {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadReference)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -0,0 +1,163 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-flyway is a kubectl plugin inspecting flyway migrations and requesting actions from the operator,
+// run as kubectl flyway <command>.
+package main
+
+import (
+	"context"
+	"os"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/davidkarlsen/flyway-operator/internal/controller"
+	"github.com/davidkarlsen/flyway-operator/internal/plugin"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(flywayv1alpha1.AddToScheme(scheme))
+}
+
+// options are the flags selecting the cluster and namespace, as kubectl passes them on to plugins
+type options struct {
+	overrides     clientcmd.ConfigOverrides
+	loadingRules  *clientcmd.ClientConfigLoadingRules
+	allNamespaces bool
+}
+
+// newPlugin connects to the cluster and returns the plugin along with the namespace to use.
+func (o *options) newPlugin(cmd *cobra.Command) (*plugin.Plugin, string, error) {
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(o.loadingRules, &o.overrides)
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, "", err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &plugin.Plugin{Client: c, LogReader: &controller.PodLogReader{Clientset: clientset}, Out: cmd.OutOrStdout()}, namespace, nil
+}
+
+// migrationCommand creates a command acting on the migration named by its argument.
+func (o *options) migrationCommand(use string, short string, run func(ctx context.Context, p *plugin.Plugin, key types.NamespacedName) error) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " MIGRATION",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, namespace, err := o.newPlugin(cmd)
+			if err != nil {
+				return err
+			}
+			return run(cmd.Context(), p, types.NamespacedName{Namespace: namespace, Name: args[0]})
+		},
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	o := &options{loadingRules: clientcmd.NewDefaultClientConfigLoadingRules()}
+	root := &cobra.Command{
+		Use:          "kubectl-flyway",
+		Short:        "Inspect flyway migrations and request actions from the flyway-operator",
+		SilenceUsage: true,
+	}
+	flags := root.PersistentFlags()
+	flags.StringVar(&o.loadingRules.ExplicitPath, "kubeconfig", "", "Path to the kubeconfig file")
+	flags.StringVar(&o.overrides.CurrentContext, "context", "", "The kubeconfig context to use")
+	flags.StringVarP(&o.overrides.Context.Namespace, "namespace", "n", "", "The namespace of the migrations")
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "List the migrations with their versions, pending migrations and last run",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			p, namespace, err := o.newPlugin(cmd)
+			if err != nil {
+				return err
+			}
+			if o.allNamespaces {
+				namespace = ""
+			}
+			return p.Status(cmd.Context(), namespace)
+		},
+	}
+	status.Flags().BoolVarP(&o.allNamespaces, "all-namespaces", "A", false, "List the migrations of all namespaces")
+
+	var target string
+	logs := o.migrationCommand("logs", "Print the flyway log of the most recent job of the migration",
+		func(ctx context.Context, p *plugin.Plugin, key types.NamespacedName) error {
+			return p.Logs(ctx, key, target)
+		})
+	logs.Flags().StringVar(&target, "target", "", "Only consider the jobs of the named database")
+
+	root.AddCommand(
+		status,
+		logs,
+		o.migrationCommand("history", "Print the runs recorded for the migration",
+			func(ctx context.Context, p *plugin.Plugin, key types.NamespacedName) error {
+				return p.History(ctx, key)
+			}),
+		o.migrationCommand("pause", "Stop the migration from creating jobs",
+			func(ctx context.Context, p *plugin.Plugin, key types.NamespacedName) error {
+				return p.Pause(ctx, key, true)
+			}),
+		o.migrationCommand("resume", "Resume a paused migration",
+			func(ctx context.Context, p *plugin.Plugin, key types.NamespacedName) error {
+				return p.Pause(ctx, key, false)
+			}),
+		o.migrationCommand("retry", "Run the failed jobs of the migration anew",
+			func(ctx context.Context, p *plugin.Plugin, key types.NamespacedName) error {
+				return p.Retry(ctx, key)
+			}),
+		o.migrationCommand("repair", "Run flyway repair against the databases of the migration",
+			func(ctx context.Context, p *plugin.Plugin, key types.NamespacedName) error {
+				return p.Repair(ctx, key)
+			}),
+		o.migrationCommand("approve", "Approve the pending migrations awaiting approval",
+			func(ctx context.Context, p *plugin.Plugin, key types.NamespacedName) error {
+				return p.Approve(ctx, key)
+			}),
+	)
+
+	return root
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
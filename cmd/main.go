@@ -17,13 +17,18 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/redhat-cop/operator-utils/pkg/util"
+	"github.com/samber/lo"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -32,6 +37,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -40,6 +46,9 @@ import (
 
 	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
 	"github.com/davidkarlsen/flyway-operator/internal/controller"
+	"github.com/davidkarlsen/flyway-operator/internal/tracing"
+	"github.com/davidkarlsen/flyway-operator/internal/waitfor"
+	webhookv1 "github.com/davidkarlsen/flyway-operator/internal/webhook/v1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -62,6 +71,13 @@ func main() {
 	var secureMetrics bool
 	var metricsCertPath, metricsCertName, metricsCertKey string
 	var tlsOpts []func(*tls.Config)
+	var cleanDisabledNamespaces string
+	var lockNamespace, operatorNamespace string
+	var allowPrivateReceivers bool
+	var enablePodWebhook bool
+	var waitForImage, waitFor, waitForVersion string
+	var otlpEndpoint string
+	var otlpInsecure bool
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -75,6 +91,24 @@ func main() {
 		"The directory that contains the metrics server certificate.")
 	flag.StringVar(&metricsCertName, "metrics-cert-name", "tls.crt", "The name of the metrics server certificate file.")
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
+	flag.StringVar(&cleanDisabledNamespaces, "clean-disabled-namespaces", "",
+		"Comma-separated list of namespaces in which flyway clean is never run, use * for all namespaces.")
+	flag.StringVar(&lockNamespace, "lock-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace holding the leases which lock databases across migrations, the namespace of each migration if empty.")
+	flag.StringVar(&operatorNamespace, "operator-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace of the operator, holding the secrets of the receivers of ClusterNotificationPolicies.")
+	flag.BoolVar(&allowPrivateReceivers, "allow-private-notification-receivers", false,
+		"If set, notification policies may post to loopback, link-local and private addresses, like the services of the cluster.")
+	flag.BoolVar(&enablePodWebhook, "enable-pod-webhook", false,
+		"If set, pods annotated with "+flywayv1alpha1.WaitFor+" get an init container waiting for the migration.")
+	flag.StringVar(&waitForImage, "wait-for-image", os.Getenv("WAIT_FOR_IMAGE"),
+		"The image of the operator, which runs the init container waiting for a migration.")
+	flag.StringVar(&waitFor, "wait-for", "",
+		"Wait for the migration, given as name or namespace/name, to be applied and exit, instead of running the manager.")
+	flag.StringVar(&waitForVersion, "wait-for-version", "", "The lowest schema version to wait for, along with --wait-for.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"The host:port of the OTLP/gRPC collector to export traces to, tracing is disabled if empty.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "If set, traces are exported without TLS.")
 
 	opts := zap.Options{
 		Development: true,
@@ -84,6 +118,21 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if waitFor != "" {
+		os.Exit(runWaitFor(waitFor, waitForVersion))
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	shutdownTracing := func(context.Context) error { return nil }
+	if otlpEndpoint != "" {
+		setupLog.Info("exporting traces", "endpoint", otlpEndpoint)
+		var err error
+		if shutdownTracing, err = tracing.Setup(ctx, otlpEndpoint, otlpInsecure); err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+	}
+
 	// Create watchers for metrics and webhooks certificates
 	var metricsCertWatcher *certwatcher.CertWatcher
 
@@ -165,14 +214,50 @@ func main() {
 		}
 	}
 
+	migrationRecorder := mgr.GetEventRecorder("Migration")
 	if err = (&controller.MigrationReconciler{
-		ReconcilerBase: util.NewFromManager(mgr, mgr.GetEventRecorderFor("Migration")), //nolint:staticcheck // SA1019 - GetEventRecorderFor is deprecated
+		ReconcilerBase: util.NewFromManager(mgr, controller.NewEventRecorder(migrationRecorder, mgr.GetClient(), "Migration")),
 		Client:         mgr.GetClient(),
 		Scheme:         mgr.GetScheme(),
+		Recorder:       migrationRecorder,
+		CleanDisabledNamespaces: lo.Compact(lo.Map(strings.Split(cleanDisabledNamespaces, ","), func(namespace string, _ int) string {
+			return strings.TrimSpace(namespace)
+		})),
+		LogReader:             &controller.PodLogReader{Clientset: kubernetes.NewForConfigOrDie(mgr.GetConfig())},
+		LockNamespace:         lockNamespace,
+		OperatorNamespace:     operatorNamespace,
+		AllowPrivateReceivers: allowPrivateReceivers,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Migration")
 		os.Exit(1)
 	}
+	if err = (&controller.MigrationRunReconciler{
+		ReconcilerBase: util.NewFromManager(mgr, controller.NewEventRecorder(mgr.GetEventRecorder("MigrationRun"), mgr.GetClient(), "MigrationRun")),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		LockNamespace:  lockNamespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MigrationRun")
+		os.Exit(1)
+	}
+	if err = (&controller.SchemaRequirementReconciler{
+		ReconcilerBase: util.NewFromManager(mgr, controller.NewEventRecorder(mgr.GetEventRecorder("SchemaRequirement"), mgr.GetClient(), "SchemaRequirement")),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SchemaRequirement")
+		os.Exit(1)
+	}
+	if enablePodWebhook {
+		if waitForImage == "" {
+			setupLog.Error(nil, "the pod webhook requires --wait-for-image")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupPodWebhookWithManager(mgr, waitForImage); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -185,8 +270,35 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctx)
+	// the context is done by now, the spans are flushed within a grace period
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		setupLog.Error(err, "unable to flush traces")
+	}
+	cancel()
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// runWaitFor waits for the migration to be applied, it returns the exit code of the init container.
+func runWaitFor(reference string, version string) int {
+	key, err := waitfor.ParseReference(reference, os.Getenv("POD_NAMESPACE"))
+	if err != nil {
+		setupLog.Error(err, "unable to wait for migration")
+		return 1
+	}
+	reader, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		setupLog.Error(err, "unable to create client")
+		return 1
+	}
+	if err := waitfor.Wait(ctrl.LoggerInto(ctrl.SetupSignalHandler(), setupLog), reader, key, version, 5*time.Second); err != nil {
+		setupLog.Error(err, "unable to wait for migration", "migration", key)
+		return 1
+	}
+
+	return 0
+}
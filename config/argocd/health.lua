@@ -0,0 +1,44 @@
+-- Health of a flyway-operator Migration for Argo CD, following the kstatus conditions set by the operator:
+-- Degraded when Stalled, Healthy when Ready, Suspended while paused, and Progressing otherwise.
+local hs = {}
+if obj.status == nil or obj.status.observedGeneration == nil or obj.status.observedGeneration ~= obj.metadata.generation then
+  hs.status = "Progressing"
+  hs.message = "Waiting for the operator to reconcile the migration"
+  return hs
+end
+
+local conditions = {}
+if obj.status.conditions ~= nil then
+  for _, condition in ipairs(obj.status.conditions) do
+    conditions[condition.type] = condition
+  end
+end
+
+local function isTrue(conditionType)
+  return conditions[conditionType] ~= nil and conditions[conditionType].status == "True"
+end
+
+local function describe(conditionType)
+  if obj.status.summary ~= nil and obj.status.summary ~= "" then
+    return obj.status.summary
+  end
+  if conditions[conditionType] ~= nil then
+    return conditions[conditionType].message
+  end
+  return ""
+end
+
+if isTrue("Stalled") then
+  hs.status = "Degraded"
+  hs.message = conditions["Stalled"].message
+elseif isTrue("Ready") then
+  hs.status = "Healthy"
+  hs.message = describe("Ready")
+elseif isTrue("Paused") then
+  hs.status = "Suspended"
+  hs.message = describe("Paused")
+else
+  hs.status = "Progressing"
+  hs.message = describe("Reconciling")
+end
+return hs
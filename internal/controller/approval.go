@@ -0,0 +1,163 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// getPendingHash identifies the pending migrations of all targets along with the image they were found in,
+// it is empty when nothing is pending.
+func getPendingHash(statuses []flywayv1alpha1.TargetStatus, source string) string {
+	lines := lo.FilterMap(statuses, func(status flywayv1alpha1.TargetStatus, _ int) (string, bool) {
+		return fmt.Sprintf("%s: %s", status.Name, strings.Join(status.PendingMigrations, ", ")), len(status.PendingMigrations) > 0
+	})
+	if len(lines) == 0 {
+		return ""
+	}
+	slices.Sort(lines)
+	if source != "" {
+		lines = append(lines, "source: "+source)
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// isApprovalChecked returns true if info has reported the pending migrations of all targets at the current generation.
+func isApprovalChecked(migration *flywayv1alpha1.Migration) bool {
+	return lo.EveryBy(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) bool {
+		return status.Phase == flywayv1alpha1.TargetSucceeded && status.Generation == migration.Generation
+	})
+}
+
+// setApproval records the pending migrations to approve, found by info in the source for the targets.
+// It returns whether there are new pending migrations to approve.
+func setApproval(migration *flywayv1alpha1.Migration, source string) bool {
+	migration.Status.Approval = &flywayv1alpha1.ApprovalStatus{
+		Generation: migration.Generation,
+		Hash:       getPendingHash(migration.Status.Targets, source),
+		Targets:    lo.Map(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus, _ int) string { return status.Name }),
+		Source:     source,
+	}
+
+	return migration.Status.Approval.Hash != ""
+}
+
+// isApprovalCurrent returns true if the approval was recorded for the current generation and all targets, the pending
+// migrations of databases found later have not been approved.
+func isApprovalCurrent(migration *flywayv1alpha1.Migration, targets []flywayv1alpha1.DatabaseTarget) bool {
+	approval := migration.Status.Approval
+	return approval != nil && approval.Generation == migration.Generation &&
+		lo.EveryBy(targets, func(target flywayv1alpha1.DatabaseTarget) bool { return lo.Contains(approval.Targets, target.Name) })
+}
+
+// reconcileApproval records the pending migrations to approve once info has reported them for all targets.
+// The pending migrations are approved along with the image info found them in, which is read from the pods of the info
+// jobs, and the approved migrations are applied from that image. When the image of a mutable tag changed while info ran,
+// the pending migrations are checked again. It returns whether there are new pending migrations to approve.
+func (r *MigrationReconciler) reconcileApproval(ctx context.Context, migration *flywayv1alpha1.Migration,
+	targets []flywayv1alpha1.DatabaseTarget) (bool, error) {
+	if isApprovalCurrent(migration, targets) || !isApprovalChecked(migration) {
+		return false, nil
+	}
+
+	var sources []string
+	jobs := make([]*batchv1.Job, 0, len(targets))
+	for _, target := range targets {
+		job, err := r.getExistingJob(ctx, migration, getActionJobName(migration, target, actionInfo))
+		if err != nil || job == nil {
+			return false, err
+		}
+		pod, err := r.getLatestJobPod(ctx, job)
+		if err != nil {
+			return false, err
+		}
+		sources = append(sources, getSource(job, pod))
+		jobs = append(jobs, job)
+	}
+	sources = lo.Uniq(sources)
+	if len(sources) > 1 {
+		log.FromContext(ctx).Info("The migration image changed while checking for pending migrations, checking again", "sources", sources)
+		for _, job := range jobs {
+			if err := r.GetClient().Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	return setApproval(migration, lo.FirstOrEmpty(sources)), nil
+}
+
+// pinApprovedSource makes the job apply the approved migrations from the image they were approved in,
+// when approval is required and the digest of the image is known.
+func pinApprovedSource(migration *flywayv1alpha1.Migration, job *batchv1.Job) {
+	approval := migration.Status.Approval
+	if migration.Spec.Approval == nil || !migration.Spec.Approval.Required || approval == nil ||
+		approval.Generation != migration.Generation || !strings.Contains(approval.Source, "@") {
+		return
+	}
+
+	for i := range job.Spec.Template.Spec.InitContainers {
+		if job.Spec.Template.Spec.InitContainers[i].Name == copySqlContainerName {
+			job.Spec.Template.Spec.InitContainers[i].Image = approval.Source
+		}
+	}
+}
+
+// setApprovalCondition flags pending migrations awaiting approval.
+func setApprovalCondition(migration *flywayv1alpha1.Migration) {
+	if migration.Spec.Approval == nil || !migration.Spec.Approval.Required {
+		meta.RemoveStatusCondition(&migration.Status.Conditions, flywayv1alpha1.ConditionPendingApproval)
+		return
+	}
+
+	condition := metav1.Condition{
+		Type:               flywayv1alpha1.ConditionPendingApproval,
+		ObservedGeneration: migration.Generation,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Approved",
+	}
+	approval := migration.Status.Approval
+	switch {
+	case approval == nil || approval.Generation != migration.Generation:
+		condition.Reason = "CheckingPendingMigrations"
+	case migration.IsApproved():
+		// approved, or nothing to approve
+	default:
+		pending := lo.SumBy(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) int { return len(status.PendingMigrations) })
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "AwaitingApproval"
+		condition.Message = fmt.Sprintf("%d pending migrations await approval, approve with the annotation %s=%s",
+			pending, flywayv1alpha1.Approve, approval.Hash)
+	}
+	meta.SetStatusCondition(&migration.Status.Conditions, condition)
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileApproval(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace", Generation: 1},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			Approval: &flywayv1alpha1.Approval{Required: true},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(dryRunOutput)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	// info runs first, to find the pending migrations
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKey{Namespace: migration.Namespace, Name: "some-migration-info-150623d9"}, job))
+	testhelper.AssertEquals(t, "info", job.Spec.Template.Spec.Containers[0].Args[0])
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	for range 2 {
+		_, err = r.Reconcile(ctx, req)
+		testhelper.AssertNoErr(t, err)
+	}
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, meta.IsStatusConditionTrue(updated.Status.Conditions, flywayv1alpha1.ConditionPendingApproval))
+	testhelper.AssertEquals(t, false, isReady(updated))
+	hash := updated.Status.Approval.Hash
+	// without the pod of the info job, the pending migrations are approved along with the tag of the image
+	testhelper.AssertEquals(t, getPendingHash(updated.Status.Targets, "somereg.io/someimage:sometag"), hash)
+	testhelper.AssertDeepEquals(t, []string{flywayv1alpha1.DefaultTarget}, updated.Status.Approval.Targets)
+	err = r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), &batchv1.Job{})
+	testhelper.AssertEquals(t, true, err != nil)
+
+	// approving another set of migrations does not apply them
+	updated.Annotations = map[string]string{flywayv1alpha1.Approve: "0123456789abcdef"}
+	testhelper.AssertNoErr(t, r.GetClient().Update(ctx, updated))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	err = r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), &batchv1.Job{})
+	testhelper.AssertEquals(t, true, err != nil)
+
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	updated.Annotations = map[string]string{flywayv1alpha1.Approve: hash}
+	testhelper.AssertNoErr(t, r.GetClient().Update(ctx, updated))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), &batchv1.Job{}))
+}
+
+func TestGetPendingHash(t *testing.T) {
+	statuses := []flywayv1alpha1.TargetStatus{
+		{Name: "tenant-a", PendingMigrations: []string{"V2__a.sql"}},
+		{Name: "tenant-b"},
+	}
+	testhelper.AssertEquals(t, "", getPendingHash([]flywayv1alpha1.TargetStatus{{Name: "tenant-a"}}, "some-source"))
+	testhelper.AssertEquals(t, getPendingHash(statuses, ""), getPendingHash([]flywayv1alpha1.TargetStatus{statuses[1], statuses[0]}, ""))
+	// the same migrations found in another image are approved anew
+	testhelper.CheckEquals(t, true, getPendingHash(statuses, "some-source") != getPendingHash(statuses, "other-source"))
+	statuses[1].PendingMigrations = []string{"V2__a.sql"}
+	testhelper.AssertEquals(t, 16, len(getPendingHash(statuses, "")))
+}
+
+func TestIsApprovalCurrent(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+	targets := []flywayv1alpha1.DatabaseTarget{{Name: "tenant-a"}, {Name: "tenant-b"}}
+
+	testhelper.AssertEquals(t, false, isApprovalCurrent(migration, targets))
+	migration.Status.Approval = &flywayv1alpha1.ApprovalStatus{Generation: 2, Targets: []string{"tenant-a", "tenant-b", "tenant-c"}}
+	testhelper.AssertEquals(t, true, isApprovalCurrent(migration, targets))
+	// a database found after the approval
+	testhelper.AssertEquals(t, false, isApprovalCurrent(migration, append(targets, flywayv1alpha1.DatabaseTarget{Name: "tenant-d"})))
+	migration.Status.Approval.Generation = 1
+	testhelper.AssertEquals(t, false, isApprovalCurrent(migration, targets))
+}
+
+// newApprovalMigration returns a migration requiring approval of its databases
+func newApprovalMigration(names ...string) *flywayv1alpha1.Migration {
+	return &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace", Generation: 1},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Databases: lo.Map(names, func(name string, _ int) flywayv1alpha1.DatabaseTarget {
+				return flywayv1alpha1.DatabaseTarget{Name: name, Database: flywayv1alpha1.Database{
+					Username: "someUser",
+					JdbcUrl:  "jdbc:postgresql://somehost/" + name,
+				}}
+			}),
+			Approval: &flywayv1alpha1.Approval{Required: true},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+}
+
+// completeInfoJob completes the info job of the target, whose pod ran the migration image of the digest
+func completeInfoJob(t *testing.T, r *MigrationReconciler, migration *flywayv1alpha1.Migration, target string, imageID string) {
+	ctx := context.TODO()
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKey{Namespace: migration.Namespace, Name: getName(migration.Name, target, actionInfo)}, job))
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-pod", Namespace: job.Namespace, Labels: map[string]string{batchv1.JobNameLabel: job.Name}},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{Name: copySqlContainerName, ImageID: imageID}},
+		},
+	}
+	testhelper.AssertNoErr(t, r.GetClient().Create(ctx, pod))
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+}
+
+func TestReconcileApprovalPinsSource(t *testing.T) {
+	const digest = "somereg.io/someimage@sha256:0123456789abcdef"
+	migration := newApprovalMigration("tenant-a")
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(dryRunOutput)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	completeInfoJob(t, r, migration, "tenant-a", "docker-pullable://"+digest)
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, digest, updated.Status.Approval.Source)
+	updated.Annotations = map[string]string{flywayv1alpha1.Approve: updated.Status.Approval.Hash}
+	testhelper.AssertNoErr(t, r.GetClient().Update(ctx, updated))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	// the approved migrations are applied from the image they were found in, even if the tag has moved since
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKey{Namespace: migration.Namespace, Name: "some-migration-tenant-a-b4bb00b6"}, job))
+	testhelper.AssertEquals(t, digest, getSource(job, nil))
+}
+
+func TestReconcileApprovalOfChangedSource(t *testing.T) {
+	migration := newApprovalMigration("tenant-a", "tenant-b")
+	migration.Spec.MaxConcurrency = 2
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(dryRunOutput)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	// the tag moved while info ran
+	completeInfoJob(t, r, migration, "tenant-a", "somereg.io/someimage@sha256:0123456789abcdef")
+	completeInfoJob(t, r, migration, "tenant-b", "somereg.io/someimage@sha256:fedcba9876543210")
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	// the pending migrations are checked again, rather than approved for either image
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, updated.Status.Approval == nil)
+	jobs := &batchv1.JobList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(migration.Namespace)))
+	testhelper.AssertEquals(t, 0, len(jobs.Items))
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// reconcileDependencies reports whether the migrations the migration depends on are ready.
+// It returns the dependencies which are not, missing ones included.
+func (r *MigrationReconciler) reconcileDependencies(ctx context.Context, migration *flywayv1alpha1.Migration) ([]string, error) {
+	if len(migration.Spec.DependsOn) == 0 {
+		meta.RemoveStatusCondition(&migration.Status.Conditions, flywayv1alpha1.ConditionDependenciesReady)
+		return nil, nil
+	}
+
+	// the migrations of a cycle wait for each other forever, which is reported rather than waited for
+	cycle, err := r.findDependencyCycle(ctx, migration)
+	if err != nil {
+		return nil, err
+	}
+	if cycle != nil {
+		meta.SetStatusCondition(&migration.Status.Conditions, metav1.Condition{
+			Type:               flywayv1alpha1.ConditionDependenciesReady,
+			ObservedGeneration: migration.Generation,
+			Status:             metav1.ConditionFalse,
+			Reason:             "DependencyCycle",
+			Message:            fmt.Sprintf("dependency cycle %s", strings.Join(cycle, " -> ")),
+		})
+		return cycle[1:2], nil
+	}
+
+	var unready []string
+	for _, reference := range migration.Spec.DependsOn {
+		key := reference.GetNamespacedName(migration.Namespace)
+		dependency := &flywayv1alpha1.Migration{}
+		err := r.GetClient().Get(ctx, key, dependency)
+		switch {
+		case apierrors.IsNotFound(err):
+			unready = append(unready, fmt.Sprintf("%s (not found)", key))
+		case err != nil:
+			return nil, err
+		case !dependency.IsReady():
+			unready = append(unready, key.String())
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               flywayv1alpha1.ConditionDependenciesReady,
+		ObservedGeneration: migration.Generation,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            "all dependencies are ready",
+	}
+	if len(unready) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "WaitingForDependencies"
+		condition.Message = fmt.Sprintf("waiting for %s", strings.Join(unready, ", "))
+	}
+	meta.SetStatusCondition(&migration.Status.Conditions, condition)
+
+	return unready, nil
+}
+
+// findDependencyCycle follows the dependencies of the migration transitively, and returns the cycle leading back to
+// it, starting and ending with the migration, if there is one. Cycles among the dependencies which do not lead back to
+// the migration are reported by the migrations of those cycles.
+func (r *MigrationReconciler) findDependencyCycle(ctx context.Context, migration *flywayv1alpha1.Migration) ([]string, error) {
+	self := client.ObjectKeyFromObject(migration)
+	visited := map[types.NamespacedName]bool{}
+	var walk func(current *flywayv1alpha1.Migration, path []string) ([]string, error)
+	walk = func(current *flywayv1alpha1.Migration, path []string) ([]string, error) {
+		for _, reference := range current.Spec.DependsOn {
+			key := reference.GetNamespacedName(current.Namespace)
+			if key == self {
+				return append(slices.Clone(path), key.String()), nil
+			}
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			dependency := &flywayv1alpha1.Migration{}
+			err := r.GetClient().Get(ctx, key, dependency)
+			switch {
+			case apierrors.IsNotFound(err):
+				continue
+			case err != nil:
+				return nil, err
+			}
+			cycle, err := walk(dependency, append(slices.Clone(path), key.String()))
+			if err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+
+		return nil, nil
+	}
+
+	return walk(migration, []string{self.String()})
+}
+
+// setTargetsWaitingForDependencies flags the targets waiting for the dependencies of the migration.
+func setTargetsWaitingForDependencies(statuses []flywayv1alpha1.TargetStatus, waiting []flywayv1alpha1.DatabaseTarget, unready []string) {
+	for _, target := range waiting {
+		for i := range statuses {
+			if statuses[i].Name == target.Name {
+				statuses[i].Message = fmt.Sprintf("waiting for %s", strings.Join(unready, ", "))
+			}
+		}
+	}
+}
+
+// findDependants maps a migration to the migrations depending on it,
+// so that these are applied as soon as it is ready.
+func (r *MigrationReconciler) findDependants(ctx context.Context, dependency client.Object) []reconcile.Request {
+	migrations := &flywayv1alpha1.MigrationList{}
+	if err := r.GetClient().List(ctx, migrations); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list migrations")
+		return nil
+	}
+
+	return lo.FilterMap(migrations.Items, func(migration flywayv1alpha1.Migration, _ int) (reconcile.Request, bool) {
+		dependsOn := lo.ContainsBy(migration.Spec.DependsOn, func(reference flywayv1alpha1.MigrationReference) bool {
+			return reference.GetNamespacedName(migration.Namespace) == client.ObjectKeyFromObject(dependency)
+		})
+
+		return reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&migration)}, dependsOn
+	})
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileDependsOn(t *testing.T) {
+	dependency := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared-schema", Namespace: "shared", Generation: 2},
+		Status: flywayv1alpha1.MigrationStatus{
+			Conditions: []metav1.Condition{{Type: flywayv1alpha1.ConditionReady, Status: metav1.ConditionTrue, ObservedGeneration: 1}},
+		},
+	}
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			DependsOn: []flywayv1alpha1.MigrationReference{{Name: "shared-schema", Namespace: "shared"}},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(dependency, migration)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	// the dependency is being changed
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	err = r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), &batchv1.Job{})
+	testhelper.AssertEquals(t, true, err != nil)
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	condition := meta.FindStatusCondition(updated.Status.Conditions, flywayv1alpha1.ConditionDependenciesReady)
+	testhelper.AssertEquals(t, metav1.ConditionFalse, condition.Status)
+	testhelper.AssertEquals(t, "waiting for shared/shared-schema", condition.Message)
+	testhelper.AssertEquals(t, "waiting for shared/shared-schema", updated.Status.Targets[0].Message)
+
+	testhelper.AssertDeepEquals(t, []reconcile.Request{req}, r.findDependants(ctx, dependency))
+	testhelper.AssertEquals(t, 0, len(r.findDependants(ctx, migration)))
+
+	meta.SetStatusCondition(&dependency.Status.Conditions,
+		metav1.Condition{Type: flywayv1alpha1.ConditionReady, Status: metav1.ConditionTrue, ObservedGeneration: 2, Reason: "Succeeded"})
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, dependency))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), &batchv1.Job{}))
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, meta.IsStatusConditionTrue(updated.Status.Conditions, flywayv1alpha1.ConditionDependenciesReady))
+}
+
+func TestReconcileDependsOnMissing(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			DependsOn: []flywayv1alpha1.MigrationReference{{Name: "other-migration"}},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	r := newTestReconciler(migration)
+	unready, err := r.reconcileDependencies(context.TODO(), migration)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertDeepEquals(t, []string{"some-namespace/other-migration (not found)"}, unready)
+
+	// depending on itself is the shortest cycle
+	migration.Spec.DependsOn[0].Name = migration.Name
+	unready, err = r.reconcileDependencies(context.TODO(), migration)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertDeepEquals(t, []string{"some-namespace/some-migration"}, unready)
+	condition := meta.FindStatusCondition(migration.Status.Conditions, flywayv1alpha1.ConditionDependenciesReady)
+	testhelper.AssertEquals(t, "DependencyCycle", condition.Reason)
+	testhelper.AssertEquals(t, "dependency cycle some-namespace/some-migration -> some-namespace/some-migration", condition.Message)
+}
+
+func TestReconcileDependencyCycle(t *testing.T) {
+	newDependentMigration := func(name string, namespace string, dependsOn ...flywayv1alpha1.MigrationReference) *flywayv1alpha1.Migration {
+		return &flywayv1alpha1.Migration{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: flywayv1alpha1.MigrationSpec{
+				Database: &flywayv1alpha1.Database{
+					Username: "someUser",
+					JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+				},
+				DependsOn: dependsOn,
+				MigrationSource: flywayv1alpha1.MigrationSource{
+					ImageRef: "somereg.io/someimage:sometag",
+				},
+			},
+		}
+	}
+	// a -> b -> c -> a, where b also depends on the missing d, and c on the unrelated cycle e -> f -> e
+	a := newDependentMigration("a", "some-namespace", flywayv1alpha1.MigrationReference{Name: "b", Namespace: "shared"})
+	b := newDependentMigration("b", "shared", flywayv1alpha1.MigrationReference{Name: "d"}, flywayv1alpha1.MigrationReference{Name: "c"})
+	c := newDependentMigration("c", "shared",
+		flywayv1alpha1.MigrationReference{Name: "e"}, flywayv1alpha1.MigrationReference{Name: "a", Namespace: "some-namespace"})
+	e := newDependentMigration("e", "shared", flywayv1alpha1.MigrationReference{Name: "f"})
+	f := newDependentMigration("f", "shared", flywayv1alpha1.MigrationReference{Name: "e"})
+
+	ctx := context.TODO()
+	r := newTestReconciler(a, b, c, e, f)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(a)}
+
+	// the migration is not applied, and the cycle is reported
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	err = r.GetClient().Get(ctx, client.ObjectKeyFromObject(a), &batchv1.Job{})
+	testhelper.AssertEquals(t, true, err != nil)
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	condition := meta.FindStatusCondition(updated.Status.Conditions, flywayv1alpha1.ConditionDependenciesReady)
+	testhelper.AssertEquals(t, metav1.ConditionFalse, condition.Status)
+	testhelper.AssertEquals(t, "DependencyCycle", condition.Reason)
+	testhelper.AssertEquals(t, "dependency cycle some-namespace/a -> shared/b -> shared/c -> some-namespace/a", condition.Message)
+
+	// a cycle among the dependencies is waited for, it is reported by the migrations of that cycle
+	unready, err := r.reconcileDependencies(ctx, newDependentMigration("g", "shared", flywayv1alpha1.MigrationReference{Name: "e"}))
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertDeepEquals(t, []string{"shared/e"}, unready)
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/redhat-cop/operator-utils/pkg/util"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const maxNameLength = 63
+
+// getTargets returns the databases to migrate, discovering them if the migration has a databaseSelector.
+func getTargets(ctx context.Context, r *util.ReconcilerBase, migration *flywayv1alpha1.Migration) ([]flywayv1alpha1.DatabaseTarget, error) {
+	selector := migration.Spec.DatabaseSelector
+	if selector == nil {
+		return migration.GetTargets(), nil
+	}
+
+	secretSelector, err := metav1.LabelSelectorAsSelector(&selector.SecretSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	// secrets are read directly, so that the operator does not have to cache all secrets in the cluster
+	secrets := &corev1.SecretList{}
+	err = r.GetAPIReader().List(ctx, secrets, client.InNamespace(migration.Namespace), client.MatchingLabelsSelector{Selector: secretSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []flywayv1alpha1.DatabaseTarget
+	var invalid []flywayv1alpha1.InvalidDatabase
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		target, err := getTargetFromSecret(selector, secret)
+		if err != nil {
+			invalid = append(invalid, flywayv1alpha1.InvalidDatabase{Secret: secret.Name, ResourceVersion: secret.ResourceVersion, Message: err.Error()})
+			continue
+		}
+		targets = append(targets, target)
+	}
+	reportInvalidDatabases(r, migration, invalid)
+
+	return targets, nil
+}
+
+// reportInvalidDatabases reports the secrets which do not describe a database in the status of the migration,
+// with a warning once per version of each secret rather than on every reconcile.
+func reportInvalidDatabases(r *util.ReconcilerBase, migration *flywayv1alpha1.Migration, invalid []flywayv1alpha1.InvalidDatabase) {
+	for _, database := range invalid {
+		reported := lo.ContainsBy(migration.Status.InvalidDatabases, func(previous flywayv1alpha1.InvalidDatabase) bool {
+			return previous.Secret == database.Secret && previous.ResourceVersion == database.ResourceVersion
+		})
+		if !reported {
+			r.GetRecorder().Event(migration, corev1.EventTypeWarning, "InvalidDatabase", database.Message)
+		}
+	}
+	migration.Status.InvalidDatabases = invalid
+}
+
+// getTargetFromSecret reads the connection settings of a discovered database.
+func getTargetFromSecret(selector *flywayv1alpha1.DatabaseSelector, secret *corev1.Secret) (flywayv1alpha1.DatabaseTarget, error) {
+	jdbcUrlKey, _ := lo.Coalesce(selector.JdbcUrlKey, "jdbcUrl")
+	usernameKey, _ := lo.Coalesce(selector.UsernameKey, "username")
+	passwordKey, _ := lo.Coalesce(selector.PasswordKey, "password")
+
+	for _, key := range []string{jdbcUrlKey, usernameKey, passwordKey} {
+		if _, found := secret.Data[key]; !found {
+			return flywayv1alpha1.DatabaseTarget{}, fmt.Errorf("secret %s lacks the key %s", secret.Name, key)
+		}
+	}
+
+	return flywayv1alpha1.DatabaseTarget{
+		Name: getTargetName(secret.Name),
+		Database: flywayv1alpha1.Database{
+			Username: string(secret.Data[usernameKey]),
+			JdbcUrl:  string(secret.Data[jdbcUrlKey]),
+			Credentials: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+				Key:                  passwordKey,
+			},
+		},
+	}, nil
+}
+
+// getTargetName returns the name of the database discovered in the secret, which is used as label value and in the
+// names of its jobs. Secret names may be longer and contain dots, these are made a valid name with getName.
+func getTargetName(secretName string) string {
+	if len(validation.IsDNS1123Label(secretName)) == 0 {
+		return secretName
+	}
+
+	return getName(secretName)
+}
+
+// findMigrationsForSecret maps a secret to the migrations discovering databases with it,
+// so that new databases are migrated as soon as their secret appears.
+func (r *MigrationReconciler) findMigrationsForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	migrations := &flywayv1alpha1.MigrationList{}
+	if err := r.GetClient().List(ctx, migrations, client.InNamespace(secret.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list migrations", "namespace", secret.GetNamespace())
+		return nil
+	}
+
+	return lo.FilterMap(migrations.Items, func(migration flywayv1alpha1.Migration, _ int) (reconcile.Request, bool) {
+		if migration.Spec.DatabaseSelector == nil {
+			return reconcile.Request{}, false
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&migration.Spec.DatabaseSelector.SecretSelector)
+		if err != nil || !selector.Matches(labels.Set(secret.GetLabels())) {
+			return reconcile.Request{}, false
+		}
+
+		return reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&migration)}, true
+	})
+}
+
+// getName joins the parts to a valid name for kubernetes resources, suffixed with a hash of the parts.
+// Parts may contain the dashes they are joined with, so the hash keeps the names of different parts apart,
+// like a target foo running info and a target foo-info migrating. Names which are too long are truncated.
+func getName(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "/")))
+	suffix := hex.EncodeToString(hash[:])[:8]
+	name := strings.ReplaceAll(strings.Join(parts, "-"), ".", "-")
+	if len(name) > maxNameLength-len(suffix)-1 {
+		name = strings.TrimRight(name[:maxNameLength-len(suffix)-1], "-")
+	}
+
+	return name + "-" + suffix
+}
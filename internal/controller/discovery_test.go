@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newDatabaseSecret(name string, tenantLabel string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "some-namespace",
+			Labels:    map[string]string{"tenant": tenantLabel},
+		},
+		Data: map[string][]byte{
+			"jdbcUrl":  []byte("jdbc:postgresql://somehost/" + name),
+			"username": []byte(name),
+			"password": []byte("secret"),
+		},
+	}
+}
+
+func TestGetTargetFromSecret(t *testing.T) {
+	selector := &flywayv1alpha1.DatabaseSelector{}
+	target, err := getTargetFromSecret(selector, newDatabaseSecret("tenant-a", "true"))
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, "tenant-a", target.Name)
+	testhelper.AssertEquals(t, "jdbc:postgresql://somehost/tenant-a", target.JdbcUrl)
+	testhelper.AssertEquals(t, "tenant-a", target.Username)
+	testhelper.AssertEquals(t, "tenant-a", target.Credentials.Name)
+	testhelper.AssertEquals(t, "password", target.Credentials.Key)
+
+	_, err = getTargetFromSecret(&flywayv1alpha1.DatabaseSelector{JdbcUrlKey: "url"}, newDatabaseSecret("tenant-a", "true"))
+	testhelper.AssertErr(t, err)
+}
+
+func TestGetTargetFromLongSecret(t *testing.T) {
+	name := "tenant-a.databases." + strings.Repeat("x", 80) + ".example.com"
+	target, err := getTargetFromSecret(&flywayv1alpha1.DatabaseSelector{}, newDatabaseSecret(name, "true"))
+	testhelper.AssertNoErr(t, err)
+
+	// the name is used as label value, and in the names of jobs
+	testhelper.AssertEquals(t, 0, len(validation.IsValidLabelValue(target.Name)))
+	testhelper.AssertEquals(t, 0, len(validation.IsDNS1123Label(target.Name)))
+	testhelper.AssertEquals(t, true, strings.HasPrefix(target.Name, "tenant-a-databases-x"))
+	testhelper.AssertEquals(t, name, target.Credentials.Name)
+	migration := &flywayv1alpha1.Migration{ObjectMeta: metav1.ObjectMeta{Name: "some-migration"}}
+	testhelper.AssertEquals(t, 0, len(validation.IsDNS1123Label(getActionJobName(migration, target, actionInfo))))
+
+	// secrets whose names only differ in dots are told apart
+	other, err := getTargetFromSecret(&flywayv1alpha1.DatabaseSelector{}, newDatabaseSecret("tenant-a-databases-"+strings.Repeat("x", 80)+"-example-com", "true"))
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, target.Name != other.Name)
+	dotted, err := getTargetFromSecret(&flywayv1alpha1.DatabaseSelector{}, newDatabaseSecret("tenant.a", "true"))
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, getName("tenant.a"), dotted.Name)
+}
+
+func TestGetName(t *testing.T) {
+	testhelper.AssertEquals(t, "some-migration-tenant-a-565a179e", getName("some-migration", "tenant.a"))
+	// parts joined with dashes are told apart by the hash
+	testhelper.CheckEquals(t, true, getName("some-migration", "foo", "info") != getName("some-migration", "foo-info"))
+	testhelper.CheckEquals(t, true, getName("some-migration", "tenant-a") != getName("some-migration", "tenant.a"))
+
+	long := getName("some-migration", strings.Repeat("x", 80))
+	testhelper.AssertEquals(t, maxNameLength, len(long))
+	testhelper.AssertEquals(t, true, long != getName("some-migration", strings.Repeat("x", 81)))
+}
+
+func TestReconcileDiscoveredDatabases(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "some-migration",
+			Namespace: "some-namespace",
+		},
+		Spec: flywayv1alpha1.MigrationSpec{
+			DatabaseSelector: &flywayv1alpha1.DatabaseSelector{
+				SecretSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}},
+			},
+			MaxConcurrency: 5,
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+	tenantA := newDatabaseSecret("tenant-a", "true")
+	other := newDatabaseSecret("other", "false")
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration, tenantA, other)
+
+	targets, err := getTargets(ctx, &r.ReconcilerBase, migration)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, 1, len(targets))
+	testhelper.AssertEquals(t, "tenant-a", targets[0].Name)
+
+	key := types.NamespacedName{Namespace: "some-namespace", Name: "some-migration"}
+	testhelper.AssertDeepEquals(t, []reconcile.Request{{NamespacedName: key}}, r.findMigrationsForSecret(ctx, tenantA))
+	testhelper.AssertEquals(t, 0, len(r.findMigrationsForSecret(ctx, other)))
+}
+
+func TestReportInvalidDatabasesOnce(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "some-migration",
+			Namespace: "some-namespace",
+		},
+		Spec: flywayv1alpha1.MigrationSpec{
+			DatabaseSelector: &flywayv1alpha1.DatabaseSelector{
+				SecretSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}},
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+	invalid := newDatabaseSecret("tenant-b", "true")
+	delete(invalid.Data, "username")
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration, newDatabaseSecret("tenant-a", "true"), invalid)
+	recorder := r.Recorder.(*events.FakeRecorder)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+	reconcileAndCount := func() int {
+		_, err := r.Reconcile(ctx, req)
+		testhelper.AssertNoErr(t, err)
+		return len(lo.Filter(drainEvents(recorder), func(event string, _ int) bool { return strings.Contains(event, "InvalidDatabase") }))
+	}
+
+	// the invalid secret is warned of once, and reported in the status
+	testhelper.AssertEquals(t, 1, reconcileAndCount())
+	testhelper.AssertEquals(t, 0, reconcileAndCount())
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, 1, len(updated.Status.InvalidDatabases))
+	testhelper.AssertEquals(t, "tenant-b", updated.Status.InvalidDatabases[0].Secret)
+	testhelper.AssertEquals(t, "secret tenant-b lacks the key username", updated.Status.InvalidDatabases[0].Message)
+
+	// a change of the secret which leaves it invalid is warned of again
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(invalid), invalid))
+	invalid.Data["jdbcUrl"] = []byte("jdbc:postgresql://otherhost/tenant-b")
+	testhelper.AssertNoErr(t, r.GetClient().Update(ctx, invalid))
+	testhelper.AssertEquals(t, 1, reconcileAndCount())
+
+	// once fixed, it is no longer reported
+	invalid.Data["username"] = []byte("tenant-b")
+	testhelper.AssertNoErr(t, r.GetClient().Update(ctx, invalid))
+	testhelper.AssertEquals(t, 0, reconcileAndCount())
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, 0, len(updated.Status.InvalidDatabases))
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/robfig/cron/v3"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxDriftInCondition limits the drift listed in the Drifted condition, all drift is listed in the status of the targets
+const maxDriftInCondition = 5
+
+// createDriftCheckJobSpec creates the job checking the target for drift. Pending migrations are not drift.
+func createDriftCheckJobSpec(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) *batchv1.Job {
+	job := createCommandJobSpec(migration, target, actionDriftCheck, "info", "validate", "-ignoreMigrationPatterns=*:pending,*:future")
+	// a failed validation is a finding, not something to retry
+	job.Spec.BackoffLimit = ptr.To[int32](0)
+
+	return job
+}
+
+// getDrift returns the drift reported by info and validate.
+func getDrift(results []flywayResult) []string {
+	var drift []string
+	for _, result := range results {
+		for _, migration := range result.Migrations {
+			switch {
+			case strings.Contains(migration.State, "Failed"):
+				drift = append(drift, fmt.Sprintf("%s failed", migration.getName()))
+			case strings.HasPrefix(migration.State, "Missing"):
+				drift = append(drift, fmt.Sprintf("%s is applied, but missing from the migration source", migration.getName()))
+			case strings.HasPrefix(migration.State, "Future"):
+				drift = append(drift, fmt.Sprintf("%s is applied, but unknown to the migration source", migration.getName()))
+			}
+		}
+		for _, invalid := range result.InvalidMigrations {
+			drift = append(drift, fmt.Sprintf("%s %s: %s", invalid.Version, invalid.Description, invalid.ErrorDetails.ErrorMessage))
+		}
+	}
+
+	return lo.Uniq(drift)
+}
+
+// reconcileDriftCheck checks the targets for drift when the check is due, and reports the drift found.
+// Targets being migrated are checked at the next scheduled check. It returns when the next check is due.
+func (r *MigrationReconciler) reconcileDriftCheck(ctx context.Context, migration *flywayv1alpha1.Migration, targets []flywayv1alpha1.DatabaseTarget) (time.Duration, error) {
+	check := migration.Spec.DriftCheck
+	if check == nil {
+		meta.RemoveStatusCondition(&migration.Status.Conditions, flywayv1alpha1.ConditionDrifted)
+		migration.Status.LastDriftCheckTime = nil
+		for i := range migration.Status.Targets {
+			migration.Status.Targets[i].Drift = nil
+		}
+		driftedGauge.DeleteLabelValues(migration.Namespace, migration.Name)
+		return 0, nil
+	}
+
+	schedule, err := cron.ParseStandard(check.Schedule)
+	if err != nil {
+		return 0, fmt.Errorf("invalid drift check schedule %q: %w", check.Schedule, err)
+	}
+	now := time.Now()
+	due := migration.Status.LastDriftCheckTime == nil || !schedule.Next(migration.Status.LastDriftCheckTime.Time).After(now)
+
+	for _, target := range targets {
+		status, found := lo.Find(lo.ToSlicePtr(migration.Status.Targets), func(status *flywayv1alpha1.TargetStatus) bool { return status.Name == target.Name })
+		if !found {
+			continue
+		}
+		job, err := r.getExistingJob(ctx, migration, getActionJobName(migration, target, actionDriftCheck))
+		if err != nil {
+			return 0, err
+		}
+		// drift checks are not recorded in the history, which they would soon crowd out, but flagged once observed
+		if job != nil && isJobFinished(job) && job.Annotations[actionCompleted] != "true" {
+			if err := releaseLock(ctx, r.GetClient(), r.LockNamespace, migration, target, job.Name); err != nil {
+				return 0, err
+			}
+			r.observeDrift(ctx, migration, target, job, status)
+			patch := client.MergeFrom(job.DeepCopy())
+			job.Annotations[actionCompleted] = "true"
+			if err := r.GetClient().Patch(ctx, job, patch); err != nil {
+				return 0, err
+			}
+		}
+
+		if !due || status.Phase == flywayv1alpha1.TargetRunning || (job != nil && !isJobFinished(job)) {
+			continue
+		}
+		// a locked database is being changed, so it is checked at the next scheduled check
+		holder, err := acquireLock(ctx, r.GetClient(), r.LockNamespace, migration, target, getActionJobName(migration, target, actionDriftCheck))
+		if err != nil {
+			return 0, err
+		}
+		if holder != "" {
+			continue
+		}
+		if err := r.submitMigrationJob(ctx, migration, target, createActionJobSpec(migration, target, actionDriftCheck)); err != nil {
+			return 0, err
+		}
+	}
+	if due {
+		migration.Status.LastDriftCheckTime = &metav1.Time{Time: now}
+	}
+
+	if setDriftedCondition(migration) {
+		r.GetRecorder().Event(migration, corev1.EventTypeWarning, flywayv1alpha1.ConditionDrifted,
+			meta.FindStatusCondition(migration.Status.Conditions, flywayv1alpha1.ConditionDrifted).Message)
+	}
+
+	return time.Until(schedule.Next(now)), nil
+}
+
+// observeDrift reads the drift reported by a finished drift check into the status of the target.
+// When the check itself failed, the drift found before is kept.
+func (r *MigrationReconciler) observeDrift(ctx context.Context, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget,
+	job *batchv1.Job, status *flywayv1alpha1.TargetStatus) {
+	if r.LogReader == nil {
+		return
+	}
+
+	checkFailed := func(message string) {
+		r.GetRecorder().Event(migration, corev1.EventTypeWarning, "DriftCheckFailed",
+			fmt.Sprintf("Drift check of database %s failed: %s", target.Name, message))
+	}
+	output, err := r.LogReader.ReadLog(ctx, job)
+	if err != nil {
+		checkFailed(err.Error())
+		return
+	}
+	results, err := parseFlywayOutput(output)
+	if err != nil {
+		checkFailed(err.Error())
+		return
+	}
+
+	drift := getDrift(results)
+	if len(drift) == 0 && hasFailed(job) {
+		failure, found := lo.Find(results, func(result flywayResult) bool { return result.Error != nil })
+		if found {
+			checkFailed(failure.Error.Message)
+		} else {
+			checkFailed(getJobFailure(job))
+		}
+		return
+	}
+	status.Drift = drift
+}
+
+// setDriftedCondition reports the drift of all targets. It returns whether drift has newly been found.
+func setDriftedCondition(migration *flywayv1alpha1.Migration) bool {
+	drift := lo.FlatMap(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus, _ int) []string {
+		return lo.Map(status.Drift, func(drift string, _ int) string { return fmt.Sprintf("%s: %s", status.Name, drift) })
+	})
+	wasDrifted := meta.IsStatusConditionTrue(migration.Status.Conditions, flywayv1alpha1.ConditionDrifted)
+
+	condition := metav1.Condition{
+		Type:               flywayv1alpha1.ConditionDrifted,
+		ObservedGeneration: migration.Generation,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NoDrift",
+		Message:            "the databases match the applied migrations",
+	}
+	driftedGauge.WithLabelValues(migration.Namespace, migration.Name).Set(0)
+	if len(drift) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "DriftDetected"
+		condition.Message = strings.Join(lo.Subset(drift, 0, maxDriftInCondition), "; ")
+		if len(drift) > maxDriftInCondition {
+			condition.Message += fmt.Sprintf(" and %d more", len(drift)-maxDriftInCondition)
+		}
+		driftedGauge.WithLabelValues(migration.Namespace, migration.Name).Set(1)
+	}
+	meta.SetStatusCondition(&migration.Status.Conditions, condition)
+
+	return len(drift) > 0 && !wasDrifted
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const driftOutput = `{
+  "individualResults": [
+    {"operation": "info", "schemaVersion": "3", "migrations": [
+      {"version": "1", "description": "init", "state": "Success", "filepath": "/flyway/sql/V1__init.sql"},
+      {"version": "2", "description": "hotfix", "state": "Missing", "filepath": ""},
+      {"version": "3", "description": "add column", "state": "Failed", "filepath": "/flyway/sql/V3__add_column.sql"},
+      {"version": "4", "description": "next", "state": "Pending", "filepath": "/flyway/sql/V4__next.sql"}
+    ]},
+    {"operation": "validate", "validationSuccessful": false, "invalidMigrations": [
+      {"version": "1", "description": "init", "errorDetails": {"errorMessage": "checksum mismatch"}}
+    ]}
+  ]
+}
+`
+
+func TestGetDrift(t *testing.T) {
+	results, err := parseFlywayOutput(driftOutput)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertDeepEquals(t, []string{
+		"2 hotfix is applied, but missing from the migration source",
+		"V3__add_column.sql failed",
+		"1 init: checksum mismatch",
+	}, getDrift(results))
+
+	results, err = parseFlywayOutput(dryRunOutput)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, 0, len(getDrift(results)))
+}
+
+func TestReconcileDriftCheck(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			DriftCheck: &flywayv1alpha1.DriftCheck{Schedule: "@hourly"},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(driftOutput)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	result, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, result.RequeueAfter > 0)
+
+	// the database is being migrated, so it is checked at the next scheduled check
+	err = r.GetClient().Get(ctx, client.ObjectKey{Namespace: migration.Namespace, Name: "some-migration-driftcheck-8fddd84b"}, &batchv1.Job{})
+	testhelper.AssertEquals(t, true, err != nil)
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	updated.Status.LastDriftCheckTime = &metav1.Time{Time: updated.Status.LastDriftCheckTime.Add(-2 * time.Hour)}
+	updated.Status.Targets[0].Phase = flywayv1alpha1.TargetSucceeded
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, updated))
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKey{Namespace: migration.Namespace, Name: "some-migration-driftcheck-8fddd84b"}, job))
+	testhelper.AssertDeepEquals(t, []string{"info", "validate"}, job.Spec.Template.Spec.Containers[0].Args[:2])
+
+	job.Status.Failed = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, meta.IsStatusConditionTrue(updated.Status.Conditions, flywayv1alpha1.ConditionDrifted))
+	testhelper.AssertEquals(t, 3, len(updated.Status.Targets[0].Drift))
+	testhelper.AssertEquals(t, true, isReady(updated))
+
+	// drift checks are kept out of the history
+	for _, entry := range updated.Status.History {
+		testhelper.AssertEquals(t, "migrate", entry.Action)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/redhat-cop/operator-utils/pkg/util/crud"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	dryRunMarker         = "--- flyway-operator dry-run sql ---"
+	pendingMigrationsKey = "pending.txt"
+	dryRunSqlKey         = "dryrun.sql"
+	// maxDryRunSqlLength keeps the preview well within the size limit of a ConfigMap
+	maxDryRunSqlLength = 512 * 1024
+)
+
+// dryRunScript reports the pending migrations without applying them. Pending migrations are not a validation error here.
+// The SQL flyway would run can only be previewed with Flyway Teams, so it is only attempted when a license key is set,
+// and is printed after a marker, following the json output.
+const dryRunScript = `set -eu
+flyway info validate -outputType=json "-ignoreMigrationPatterns=*:pending,*:future" "$CONFIG_FILE_ARG"
+if [ -n "${FLYWAY_LICENSE_KEY:-}" ]; then
+  flyway migrate -dryRunOutput=/tmp/dryrun.sql "$CONFIG_FILE_ARG" > /dev/null
+  echo "$DRY_RUN_MARKER"
+  cat /tmp/dryrun.sql
+fi
+`
+
+// createDryRunJobSpec creates the job previewing the migration of the target.
+func createDryRunJobSpec(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) *batchv1.Job {
+	job := createCommandJobSpec(migration, target, actionDryRun)
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Command = []string{"sh", "-c", dryRunScript}
+	container.Args = nil
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "CONFIG_FILE_ARG", Value: getFlywayConfigFileArg()},
+		corev1.EnvVar{Name: "DRY_RUN_MARKER", Value: dryRunMarker},
+	)
+
+	return job
+}
+
+// getDryRunSql returns the SQL previewed by the dry-run, if any.
+func getDryRunSql(output string) (string, bool) {
+	_, sql, found := strings.Cut(output, dryRunMarker+"\n")
+	if len(sql) > maxDryRunSqlLength {
+		sql = sql[:maxDryRunSqlLength] + "\n-- truncated by flyway-operator\n"
+	}
+
+	return sql, found
+}
+
+// saveDryRun stores the preview of the dry-run in a ConfigMap named after the job, for reviewers to inspect.
+func (r *MigrationReconciler) saveDryRun(ctx context.Context, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget,
+	job *batchv1.Job, pending []string, output string, status *flywayv1alpha1.TargetStatus) error {
+	configMap := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: migration.Namespace,
+			Labels:    getLabels(migration, target),
+			Annotations: map[string]string{
+				flywayv1alpha1.Generation: job.Annotations[flywayv1alpha1.Generation],
+			},
+		},
+		Data: map[string]string{
+			pendingMigrationsKey: strings.Join(pending, "\n"),
+		},
+	}
+	if sql, found := getDryRunSql(output); found {
+		configMap.Data[dryRunSqlKey] = sql
+	}
+
+	if err := crud.CreateOrUpdateResource(ctx, migration, migration.Namespace, configMap); err != nil {
+		return err
+	}
+	status.DryRunConfigMap = configMap.Name
+
+	return nil
+}
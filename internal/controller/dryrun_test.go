@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const dryRunOutput = `{
+  "individualResults": [
+    {"operation": "info", "schemaVersion": "1", "migrations": [
+      {"version": "1", "description": "init", "state": "Success", "filepath": "/flyway/sql/V1__init.sql"},
+      {"version": "2", "description": "add column", "state": "Pending", "filepath": "/flyway/sql/V2__add_column.sql"},
+      {"version": "", "description": "views", "state": "Pending", "filepath": ""}
+    ]},
+    {"operation": "validate", "validationSuccessful": true}
+  ]
+}
+` + dryRunMarker + `
+ALTER TABLE some_table ADD some_column INT;
+`
+
+func TestReconcileDryRun(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "some-migration",
+			Namespace:   "some-namespace",
+			Annotations: map[string]string{"flyway-operator.davidkarlsen.com/paused": "true"},
+		},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			DryRun: true,
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(dryRunOutput)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	// the dry-run runs in place of the migration, although it is paused
+	jobs := &batchv1.JobList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(migration.Namespace)))
+	testhelper.AssertEquals(t, 1, len(jobs.Items))
+	job := &jobs.Items[0]
+	testhelper.AssertEquals(t, "some-migration-dryrun-92fc3412", job.Name)
+	testhelper.AssertDeepEquals(t, []string{"sh", "-c", dryRunScript}, job.Spec.Template.Spec.Containers[0].Command)
+
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	status := updated.Status.Targets[0]
+	testhelper.AssertDeepEquals(t, []string{"V2__add_column.sql", "R views"}, status.PendingMigrations)
+	testhelper.AssertEquals(t, "1", status.CurrentVersion)
+	testhelper.AssertEquals(t, "some-migration-dryrun-92fc3412", status.DryRunConfigMap)
+
+	// a preview is not applied, so the migration is not ready
+	ready := meta.FindStatusCondition(updated.Status.Conditions, flywayv1alpha1.ConditionReady)
+	testhelper.AssertEquals(t, metav1.ConditionFalse, ready.Status)
+	testhelper.AssertEquals(t, "DryRun", ready.Reason)
+	testhelper.AssertEquals(t, "1 of 1 databases previewed", ready.Message)
+	testhelper.AssertEquals(t, false, updated.IsReady())
+
+	configMap := &corev1.ConfigMap{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKey{Namespace: migration.Namespace, Name: status.DryRunConfigMap}, configMap))
+	testhelper.AssertEquals(t, "V2__add_column.sql\nR views", configMap.Data[pendingMigrationsKey])
+	testhelper.AssertEquals(t, "ALTER TABLE some_table ADD some_column INT;\n", configMap.Data[dryRunSqlKey])
+}
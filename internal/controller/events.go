@@ -0,0 +1,187 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The reasons of the events emitted on transitions of a migration
+const (
+	reasonJobCreated       = "JobCreated"
+	reasonJobStarted       = "JobStarted"
+	reasonJobFailed        = "JobFailed"
+	reasonRetryScheduled   = "RetryScheduled"
+	reasonMigrationApplied = "MigrationApplied"
+	reasonPaused           = "Paused"
+	reasonResumed          = "Resumed"
+)
+
+// jobStarted flags a job whose start has been reported
+const jobStarted = flywayv1alpha1.Prefix + "/" + "started"
+
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+
+// eventRecorder emits the events of the reconciler base through the events.k8s.io API
+type eventRecorder struct {
+	recorder   events.EventRecorder
+	client     client.Client
+	controller string
+	instance   string
+}
+
+// NewEventRecorder adapts the recorder to the interface of the reconciler base, which records the errors of reconciles.
+// Annotated events, which the recorder cannot annotate, are created through the client on behalf of the controller.
+func NewEventRecorder(recorder events.EventRecorder, c client.Client, controller string) record.EventRecorder {
+	hostname, _ := os.Hostname()
+	return &eventRecorder{recorder: recorder, client: c, controller: controller, instance: controller + "-" + hostname}
+}
+
+func (e *eventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	e.recorder.Eventf(object, nil, eventtype, reason, "Reconcile", "%s", message)
+}
+
+func (e *eventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	e.recorder.Eventf(object, nil, eventtype, reason, "Reconcile", messageFmt, args...)
+}
+
+// AnnotatedEventf creates the event with the annotations, like the recorder would without them.
+func (e *eventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	event, err := e.newAnnotatedEvent(object, annotations, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+	if err == nil {
+		err = e.client.Create(context.Background(), event)
+	}
+	if err != nil {
+		log.Log.Error(err, "unable to record event", "object", object, "eventType", eventtype, "reason", reason)
+	}
+}
+
+func (e *eventRecorder) newAnnotatedEvent(object runtime.Object, annotations map[string]string, eventtype, reason, message string) (*eventsv1.Event, error) {
+	regarding, err := reference.GetReference(e.client.Scheme(), object)
+	if err != nil {
+		return nil, err
+	}
+
+	return &eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: regarding.Name + ".",
+			Namespace:    lo.CoalesceOrEmpty(regarding.Namespace, metav1.NamespaceDefault),
+			Annotations:  annotations,
+		},
+		EventTime:           metav1.NowMicro(),
+		ReportingController: e.controller,
+		ReportingInstance:   e.instance,
+		Action:              "Reconcile",
+		Reason:              reason,
+		Regarding:           *regarding,
+		Note:                message,
+		Type:                eventtype,
+	}, nil
+}
+
+// getEventAction returns the action of the job as the action of its events.
+func getEventAction(action string) string {
+	return lo.PascalCase(action)
+}
+
+// recordJobCreated reports the job submitted for the target, which may be a retry of a failed one.
+func (r *MigrationReconciler) recordJobCreated(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, job *batchv1.Job, retry bool) {
+	action := getJobAction(job)
+	if retry {
+		r.Recorder.Eventf(migration, job, corev1.EventTypeNormal, reasonRetryScheduled, getEventAction(action),
+			"Retrying to %s database %s with job %s", action, target.Name, job.Name)
+		return
+	}
+	r.Recorder.Eventf(migration, job, corev1.EventTypeNormal, reasonJobCreated, getEventAction(action),
+		"Created job %s to %s database %s", job.Name, action, target.Name)
+}
+
+// recordJobStarted reports the job once its pod is running, and flags it so that it is only reported once.
+func (r *MigrationReconciler) recordJobStarted(ctx context.Context, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, job *batchv1.Job) error {
+	if job.Status.Active == 0 || job.Annotations[jobStarted] == "true" {
+		return nil
+	}
+	patch := client.MergeFrom(job.DeepCopy())
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[jobStarted] = "true"
+	if err := r.GetClient().Patch(ctx, job, patch); err != nil {
+		return err
+	}
+
+	action := getJobAction(job)
+	r.Recorder.Eventf(migration, job, corev1.EventTypeNormal, reasonJobStarted, getEventAction(action),
+		"Job %s started to %s database %s", job.Name, action, target.Name)
+	return nil
+}
+
+// recordJobFailed reports a failed job, once it is recorded in the history.
+func (r *MigrationReconciler) recordJobFailed(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, job *batchv1.Job) {
+	action := getJobAction(job)
+	r.Recorder.Eventf(migration, job, corev1.EventTypeWarning, reasonJobFailed, getEventAction(action),
+		"Job %s failed to %s database %s: %s", job.Name, action, target.Name, getJobFailure(job))
+}
+
+// isApplied returns true if the reconcile has applied the migration, or its rollback, to all databases.
+func isApplied(migration *flywayv1alpha1.Migration, action string, wasReady bool) bool {
+	return (action == actionMigrate || action == actionRollback) && !wasReady && migration.IsReady()
+}
+
+// recordMigrationApplied reports the versions the databases were taken from and to.
+func (r *MigrationReconciler) recordMigrationApplied(migration *flywayv1alpha1.Migration, action string, previousVersion string) {
+	verb := map[string]string{actionMigrate: "Migrated", actionRollback: "Rolled back"}[action]
+	r.Recorder.Eventf(migration, nil, corev1.EventTypeNormal, reasonMigrationApplied, getEventAction(action),
+		"%s %d databases from version %s to %s, source: %s", verb, len(migration.Status.Targets),
+		lo.CoalesceOrEmpty(previousVersion, "none"), lo.CoalesceOrEmpty(migration.Status.CurrentVersion, "unknown"),
+		migration.Spec.MigrationSource.ImageRef)
+}
+
+// reconcilePaused reports the migration being paused or resumed, and keeps track of it in the Paused condition.
+func (r *MigrationReconciler) reconcilePaused(migration *flywayv1alpha1.Migration, paused bool) {
+	wasPaused := meta.IsStatusConditionTrue(migration.Status.Conditions, flywayv1alpha1.ConditionPaused)
+	switch {
+	case paused && !wasPaused:
+		meta.SetStatusCondition(&migration.Status.Conditions, metav1.Condition{
+			Type:               flywayv1alpha1.ConditionPaused,
+			ObservedGeneration: migration.Generation,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Paused",
+			Message:            "no jobs are created while the migration is paused",
+		})
+		r.Recorder.Eventf(migration, nil, corev1.EventTypeNormal, reasonPaused, "Pause", "Migration paused, no jobs are created")
+	case !paused && wasPaused:
+		meta.RemoveStatusCondition(&migration.Status.Conditions, flywayv1alpha1.ConditionPaused)
+		r.Recorder.Eventf(migration, nil, corev1.EventTypeNormal, reasonResumed, "Resume", "Migration resumed")
+	}
+}
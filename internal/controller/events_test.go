@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// drainEvents returns the events emitted so far
+func drainEvents(recorder *events.FakeRecorder) []string {
+	var emitted []string
+	for len(recorder.Events) > 0 {
+		emitted = append(emitted, <-recorder.Events)
+	}
+	return emitted
+}
+
+func TestTransitionEvents(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+				Target: ptr.To("1.3"),
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(compositeOutput)
+	recorder := r.Recorder.(*events.FakeRecorder)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+	reconcileAndDrain := func() []string {
+		_, err := r.Reconcile(ctx, req)
+		testhelper.AssertNoErr(t, err)
+		return drainEvents(recorder)
+	}
+	updateJob := func(update func(job *batchv1.Job)) {
+		job := &batchv1.Job{}
+		testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+		// the fake client does not assign UIDs, which tell the jobs in the history apart
+		job.UID = types.UID(job.Name + "-" + job.ResourceVersion)
+		testhelper.AssertNoErr(t, r.GetClient().Update(ctx, job))
+		update(job)
+		testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	}
+
+	testhelper.AssertDeepEquals(t, []string{"Normal JobCreated Created job some-migration to migrate database default"}, reconcileAndDrain())
+
+	// the start is reported once
+	updateJob(func(job *batchv1.Job) { job.Status.Active = 1 })
+	testhelper.AssertDeepEquals(t, []string{"Normal JobStarted Job some-migration started to migrate database default"}, reconcileAndDrain())
+	testhelper.AssertEquals(t, 0, len(reconcileAndDrain()))
+
+	updateJob(func(job *batchv1.Job) {
+		job.Status.Active = 0
+		job.Status.Failed = 3
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"}}
+	})
+	testhelper.AssertDeepEquals(t, []string{
+		"Warning JobFailed Job some-migration failed to migrate database default: BackoffLimitExceeded: Job has reached the specified backoff limit",
+		"Normal RetryScheduled Retrying to migrate database default with job some-migration",
+	}, reconcileAndDrain())
+
+	updateJob(func(job *batchv1.Job) {
+		job.Status.Succeeded = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	})
+	applied := reconcileAndDrain()
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, updated.IsReady())
+	testhelper.AssertDeepEquals(t, []string{
+		"Normal MigrationApplied Migrated 1 databases from version none to 1.3, source: somereg.io/someimage:sometag",
+	}, applied)
+	testhelper.AssertEquals(t, 0, len(reconcileAndDrain()))
+
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	updated.Annotations = map[string]string{flywayv1alpha1.Prefix + "/paused": "true"}
+	testhelper.AssertNoErr(t, r.GetClient().Update(ctx, updated))
+	testhelper.AssertDeepEquals(t, []string{"Normal Paused Migration paused, no jobs are created"}, reconcileAndDrain())
+	testhelper.AssertEquals(t, 0, len(reconcileAndDrain()))
+
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	updated.Annotations = nil
+	testhelper.AssertNoErr(t, r.GetClient().Update(ctx, updated))
+	testhelper.AssertDeepEquals(t, []string{"Normal Resumed Migration resumed"}, reconcileAndDrain())
+}
+
+func TestAnnotatedEvent(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"}}
+	r := newTestReconciler(migration)
+
+	r.GetRecorder().AnnotatedEventf(migration, map[string]string{"some-annotation": "some-value"},
+		corev1.EventTypeNormal, "SomeReason", "some %s", "message")
+
+	recorded := &eventsv1.EventList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(context.TODO(), recorded, client.InNamespace(migration.Namespace)))
+	testhelper.AssertEquals(t, 1, len(recorded.Items))
+	event := recorded.Items[0]
+	testhelper.AssertDeepEquals(t, map[string]string{"some-annotation": "some-value"}, event.Annotations)
+	testhelper.AssertEquals(t, "some message", event.Note)
+	testhelper.AssertEquals(t, "SomeReason", event.Reason)
+	testhelper.AssertEquals(t, "Migration", event.ReportingController)
+	testhelper.AssertEquals(t, migration.Name, event.Regarding.Name)
+}
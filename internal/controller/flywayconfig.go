@@ -0,0 +1,166 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	flywayConfigVolumeName = "flyway-config"
+	flywayConfigMountPath  = "/flyway/operator"
+	flywayConfigFileName   = "flyway.toml"
+	flywayEnvironment      = "default"
+	flywaySqlPath          = "/flyway/sql"
+	// passwordEnvVar holds the database password, it is interpolated into the config-file by flyway,
+	// so that the password never ends up in the ConfigMap.
+	passwordEnvVar = "DB_PASSWORD"
+)
+
+// flywayConfig is the flyway.toml file, see https://documentation.red-gate.com/fd/toml-configuration-file-224919655.html
+type flywayConfig struct {
+	Environments map[string]flywayEnvironmentConfig `toml:"environments"`
+	Flyway       flywayNamespaceConfig              `toml:"flyway"`
+}
+
+// flywayEnvironmentConfig holds the connection settings, see https://documentation.red-gate.com/fd/environments-namespace-277578888.html
+type flywayEnvironmentConfig struct {
+	URL            string            `toml:"url"`
+	User           string            `toml:"user"`
+	Password       string            `toml:"password"`
+	Schemas        []string          `toml:"schemas,omitempty"`
+	ConnectRetries *int32            `toml:"connectRetries,omitempty"`
+	JdbcProperties map[string]string `toml:"jdbcProperties,omitempty"`
+}
+
+// flywayNamespaceConfig holds the general settings, see https://documentation.red-gate.com/fd/flyway-namespace-225021980.html
+type flywayNamespaceConfig struct {
+	Environment            string            `toml:"environment"`
+	Encoding               string            `toml:"encoding,omitempty"`
+	Locations              []string          `toml:"locations"`
+	DefaultSchema          *string           `toml:"defaultSchema,omitempty"`
+	Table                  *string           `toml:"table,omitempty"`
+	Target                 *string           `toml:"target,omitempty"`
+	CherryPick             []string          `toml:"cherryPick,omitempty"`
+	OutOfOrder             *bool             `toml:"outOfOrder,omitempty"`
+	ValidateOnMigrate      *bool             `toml:"validateOnMigrate,omitempty"`
+	CleanDisabled          *bool             `toml:"cleanDisabled,omitempty"`
+	BaselineOnMigrate      *bool             `toml:"baselineOnMigrate,omitempty"`
+	BaselineVersion        *string           `toml:"baselineVersion,omitempty"`
+	LockRetryCount         *int32            `toml:"lockRetryCount,omitempty"`
+	Mixed                  *bool             `toml:"mixed,omitempty"`
+	Group                  *bool             `toml:"group,omitempty"`
+	InstalledBy            *string           `toml:"installedBy,omitempty"`
+	SqlMigrationPrefix     *string           `toml:"sqlMigrationPrefix,omitempty"`
+	UndoSqlMigrationPrefix *string           `toml:"undoSqlMigrationPrefix,omitempty"`
+	Callbacks              []string          `toml:"callbacks,omitempty"`
+	Placeholders           map[string]string `toml:"placeholders,omitempty"`
+}
+
+func getFlywayConfig(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) *flywayConfig {
+	config := &migration.Spec.FlywayConfiguration
+	locations := config.Locations
+	if len(locations) == 0 {
+		locations = []string{"filesystem:" + flywaySqlPath}
+	}
+	cleanDisabled := config.CleanDisabled
+	if cleanDisabled == nil && migration.HasCleanCommand() {
+		// clean is disabled by default in flyway, the operator guards it instead
+		cleanDisabled = ptr.To(false)
+	}
+
+	return &flywayConfig{
+		Environments: map[string]flywayEnvironmentConfig{
+			flywayEnvironment: {
+				URL:            target.JdbcUrl,
+				User:           target.Username,
+				Password:       fmt.Sprintf("${env.%s}", passwordEnvVar),
+				Schemas:        config.Schemas,
+				ConnectRetries: config.ConnectRetries,
+				JdbcProperties: config.JdbcProperties,
+			},
+		},
+		Flyway: flywayNamespaceConfig{
+			Environment:            flywayEnvironment,
+			Encoding:               migration.Spec.MigrationSource.Encoding,
+			Locations:              locations,
+			DefaultSchema:          config.DefaultSchema,
+			Table:                  config.Table,
+			Target:                 config.Target,
+			CherryPick:             config.CherryPick,
+			OutOfOrder:             config.OutOfOrder,
+			ValidateOnMigrate:      config.ValidateOnMigrate,
+			CleanDisabled:          cleanDisabled,
+			BaselineOnMigrate:      config.BaselineOnMigrate,
+			BaselineVersion:        config.BaselineVersion,
+			LockRetryCount:         config.LockRetryCount,
+			Mixed:                  config.Mixed,
+			Group:                  config.Group,
+			InstalledBy:            config.InstalledBy,
+			SqlMigrationPrefix:     config.SqlMigrationPrefix,
+			UndoSqlMigrationPrefix: config.UndoSqlMigrationPrefix,
+			Callbacks:              config.Callbacks,
+			Placeholders:           lo.Assign(migration.Spec.MigrationSource.Placeholders, target.Placeholders),
+		},
+	}
+}
+
+// renderFlywayConfig renders the effective flyway configuration of the migration for the target as a flyway.toml file.
+func renderFlywayConfig(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) (string, error) {
+	var buf bytes.Buffer
+	encoder := toml.NewEncoder(&buf)
+	encoder.Indent = ""
+	if err := encoder.Encode(getFlywayConfig(migration, target)); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// createConfigMapSpec creates the ConfigMap holding the flyway.toml which is mounted into the migration job.
+func createConfigMapSpec(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) (*corev1.ConfigMap, error) {
+	config, err := renderFlywayConfig(migration, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getJobName(migration, target),
+			Namespace: migration.Namespace,
+			Labels:    getLabels(migration, target),
+			Annotations: map[string]string{
+				flywayv1alpha1.Generation: migration.GenerationAsString(),
+			},
+		},
+		Data: map[string]string{
+			flywayConfigFileName: config,
+		},
+	}, nil
+}
@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestRenderFlywayConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		migration flywayv1alpha1.Migration
+		expected  []string // expected lines in the rendered flyway.toml
+	}{
+		{
+			name: "basic config",
+			migration: flywayv1alpha1.Migration{
+				Spec: flywayv1alpha1.MigrationSpec{
+					Database: &flywayv1alpha1.Database{
+						Username: "testuser",
+						Credentials: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "db-secret"},
+							Key:                  "password",
+						},
+						JdbcUrl: "jdbc:testurl",
+					},
+					MigrationSource: flywayv1alpha1.MigrationSource{
+						Encoding: "UTF-8",
+					},
+				},
+			},
+			expected: []string{
+				`[environments.default]`,
+				`url = "jdbc:testurl"`,
+				`user = "testuser"`,
+				`password = "${env.DB_PASSWORD}"`,
+				`[flyway]`,
+				`environment = "default"`,
+				`encoding = "UTF-8"`,
+				`locations = ["filesystem:/flyway/sql"]`,
+			},
+		},
+		{
+			name: "baseline and schema",
+			migration: flywayv1alpha1.Migration{
+				Spec: flywayv1alpha1.MigrationSpec{
+					Database: &flywayv1alpha1.Database{
+						Username: "user2",
+						JdbcUrl:  "jdbc:url2",
+					},
+					FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+						BaselineOnMigrate: ptr.To(true),
+						DefaultSchema:     ptr.To("myschema"),
+					},
+					MigrationSource: flywayv1alpha1.MigrationSource{
+						Encoding: "ISO-8859-1",
+					},
+				},
+			},
+			expected: []string{
+				`encoding = "ISO-8859-1"`,
+				`baselineOnMigrate = true`,
+				`defaultSchema = "myschema"`,
+			},
+		},
+		{
+			name: "typed configuration",
+			migration: flywayv1alpha1.Migration{
+				Spec: flywayv1alpha1.MigrationSpec{
+					Database: &flywayv1alpha1.Database{
+						Username: "user3",
+						JdbcUrl:  "jdbc:url3",
+					},
+					FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+						Schemas:           []string{"first", "second"},
+						Table:             ptr.To("history"),
+						Target:            ptr.To("42"),
+						OutOfOrder:        ptr.To(true),
+						ValidateOnMigrate: ptr.To(false),
+						CleanDisabled:     ptr.To(true),
+						BaselineVersion:   ptr.To("1.1"),
+						ConnectRetries:    ptr.To[int32](5),
+						LockRetryCount:    ptr.To[int32](-1),
+						Mixed:             ptr.To(true),
+						Group:             ptr.To(false),
+						InstalledBy:       ptr.To("operator"),
+						Locations:         []string{"filesystem:/flyway/sql", "filesystem:/mnt/extra"},
+						Callbacks:         []string{"com.example.Callback"},
+					},
+				},
+			},
+			expected: []string{
+				`schemas = ["first", "second"]`,
+				`connectRetries = 5`,
+				`table = "history"`,
+				`target = "42"`,
+				`outOfOrder = true`,
+				`validateOnMigrate = false`,
+				`cleanDisabled = true`,
+				`baselineVersion = "1.1"`,
+				`lockRetryCount = -1`,
+				`mixed = true`,
+				`group = false`,
+				`installedBy = "operator"`,
+				`locations = ["filesystem:/flyway/sql", "filesystem:/mnt/extra"]`,
+				`callbacks = ["com.example.Callback"]`,
+			},
+		},
+		{
+			name: "cherry pick",
+			migration: flywayv1alpha1.Migration{
+				Spec: flywayv1alpha1.MigrationSpec{
+					Database: &flywayv1alpha1.Database{
+						Username: "user3",
+						JdbcUrl:  "jdbc:url3",
+					},
+					FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+						CherryPick: []string{"2.1", "refresh views"},
+					},
+				},
+			},
+			expected: []string{
+				`cherryPick = ["2.1", "refresh views"]`,
+			},
+		},
+		{
+			name: "special characters",
+			migration: flywayv1alpha1.Migration{
+				Spec: flywayv1alpha1.MigrationSpec{
+					Database: &flywayv1alpha1.Database{
+						Username: "user4",
+						JdbcUrl:  "jdbc:url4",
+					},
+					FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+						JdbcProperties: map[string]string{
+							"sslfactory": `a=b "quoted" c`,
+						},
+					},
+					MigrationSource: flywayv1alpha1.MigrationSource{
+						Placeholders: map[string]string{
+							"owner": `some\owner`,
+						},
+					},
+				},
+			},
+			expected: []string{
+				`[environments.default.jdbcProperties]`,
+				`sslfactory = "a=b \"quoted\" c"`,
+				`[flyway.placeholders]`,
+				`owner = "some\\owner"`,
+			},
+		},
+		{
+			name: "clean",
+			migration: flywayv1alpha1.Migration{
+				Spec: flywayv1alpha1.MigrationSpec{
+					Database: &flywayv1alpha1.Database{
+						Username: "user5",
+						JdbcUrl:  "jdbc:url5",
+					},
+					FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+						Commands:   []string{"clean", "migrate"},
+						AllowClean: true,
+					},
+				},
+			},
+			expected: []string{
+				`cleanDisabled = false`,
+			},
+		},
+		{
+			name: "target placeholders",
+			migration: flywayv1alpha1.Migration{
+				Spec: flywayv1alpha1.MigrationSpec{
+					Databases: []flywayv1alpha1.DatabaseTarget{
+						{
+							Name: "tenant-a",
+							Database: flywayv1alpha1.Database{
+								Username: "tenant_a",
+								JdbcUrl:  "jdbc:tenant-a",
+							},
+							Placeholders: map[string]string{
+								"tenant": "a",
+							},
+						},
+					},
+					MigrationSource: flywayv1alpha1.MigrationSource{
+						Placeholders: map[string]string{
+							"tenant": "default",
+							"owner":  "app",
+						},
+					},
+				},
+			},
+			expected: []string{
+				`url = "jdbc:tenant-a"`,
+				`user = "tenant_a"`,
+				`owner = "app"`,
+				`tenant = "a"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := renderFlywayConfig(&tt.migration, tt.migration.GetTargets()[0])
+			testhelper.AssertNoErr(t, err)
+			lines := strings.Split(config, "\n")
+			for _, expected := range tt.expected {
+				found := false
+				for _, line := range lines {
+					if line == expected {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("line %s not found in config:\n%s", expected, config)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateConfigMapSpec(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "some-migration",
+			Namespace:  "some-namespace",
+			Generation: 3,
+		},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:someurl",
+			},
+		},
+	}
+
+	target := migration.GetTargets()[0]
+	configMap, err := createConfigMapSpec(migration, target)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, "some-migration", configMap.Name)
+	testhelper.AssertEquals(t, "some-namespace", configMap.Namespace)
+	testhelper.AssertEquals(t, "3", configMap.Annotations[flywayv1alpha1.Generation])
+	testhelper.AssertEquals(t, flywayv1alpha1.DefaultTarget, configMap.Labels[flywayv1alpha1.TargetName])
+	expected, err := renderFlywayConfig(migration, target)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, expected, configMap.Data[flywayConfigFileName])
+}
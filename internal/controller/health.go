@@ -0,0 +1,136 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/redhat-cop/operator-utils/pkg/util/apis"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reasonReconcileError is the reason of the Stalled condition when the reconcile failed
+const reasonReconcileError = "ReconcileError"
+
+// manageSuccess updates the status of the migration with the conditions kstatus, and so Flux and Argo CD, expect.
+// It replaces ManageSuccess of the reconciler base, whose ReconcileSuccess condition is not understood by them.
+func (r *MigrationReconciler) manageSuccess(ctx context.Context, migration *flywayv1alpha1.Migration) (ctrl.Result, error) {
+	setHealthConditions(migration, nil)
+	setSummary(migration)
+	if err := r.GetClient().Status().Update(ctx, migration); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// manageError reports the error as a warning event and in the Stalled condition, and returns it for the migration
+// to be reconciled again. It replaces ManageError of the reconciler base.
+func (r *MigrationReconciler) manageError(ctx context.Context, migration *flywayv1alpha1.Migration, issue error) (ctrl.Result, error) {
+	r.GetRecorder().Event(migration, corev1.EventTypeWarning, "ProcessingError", issue.Error())
+	setHealthConditions(migration, issue)
+	setSummary(migration)
+	if err := r.GetClient().Status().Update(ctx, migration); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, issue
+}
+
+// setHealthConditions sets the observed generation along with the Ready, Reconciling and Stalled conditions of kstatus:
+// a migration is stalled when the reconcile, or the last run of a database, failed, and reconciling until it is ready.
+func setHealthConditions(migration *flywayv1alpha1.Migration, issue error) {
+	migration.Status.ObservedGeneration = migration.Generation
+	// conditions of the reconciler base, set by earlier versions of the operator
+	meta.RemoveStatusCondition(&migration.Status.Conditions, apis.ReconcileSuccess)
+	meta.RemoveStatusCondition(&migration.Status.Conditions, apis.ReconcileError)
+
+	paused := migration.IsPaused() && !migration.Spec.DryRun
+	ready := meta.FindStatusCondition(migration.Status.Conditions, flywayv1alpha1.ConditionReady)
+	if ready == nil || ready.ObservedGeneration != migration.Generation {
+		// the reconcile returned before the readiness of the generation was known
+		meta.SetStatusCondition(&migration.Status.Conditions, metav1.Condition{
+			Type:               flywayv1alpha1.ConditionReady,
+			ObservedGeneration: migration.Generation,
+			Status:             metav1.ConditionFalse,
+			Reason:             lo.Ternary(paused, "Paused", "Progressing"),
+			Message:            fmt.Sprintf("generation %d has yet to be applied", migration.Generation),
+		})
+		ready = meta.FindStatusCondition(migration.Status.Conditions, flywayv1alpha1.ConditionReady)
+	}
+
+	stalled := metav1.Condition{
+		Type:               flywayv1alpha1.ConditionStalled,
+		ObservedGeneration: migration.Generation,
+		Status:             metav1.ConditionTrue,
+	}
+	failed := getFailedTargets(migration)
+	switch {
+	case issue != nil:
+		stalled.Reason = reasonReconcileError
+		stalled.Message = issue.Error()
+	case len(failed) > 0:
+		stalled.Reason = "Failed"
+		stalled.Message = fmt.Sprintf("the last run failed for %s", strings.Join(failed, ", "))
+	default:
+		stalled.Status = metav1.ConditionFalse
+	}
+
+	switch {
+	case stalled.Status == metav1.ConditionTrue:
+		meta.SetStatusCondition(&migration.Status.Conditions, stalled)
+		meta.RemoveStatusCondition(&migration.Status.Conditions, flywayv1alpha1.ConditionReconciling)
+	case ready.Status != metav1.ConditionTrue && !paused:
+		meta.RemoveStatusCondition(&migration.Status.Conditions, flywayv1alpha1.ConditionStalled)
+		meta.SetStatusCondition(&migration.Status.Conditions, metav1.Condition{
+			Type:               flywayv1alpha1.ConditionReconciling,
+			ObservedGeneration: migration.Generation,
+			Status:             metav1.ConditionTrue,
+			Reason:             ready.Reason,
+			Message:            ready.Message,
+		})
+	default:
+		meta.RemoveStatusCondition(&migration.Status.Conditions, flywayv1alpha1.ConditionStalled)
+		meta.RemoveStatusCondition(&migration.Status.Conditions, flywayv1alpha1.ConditionReconciling)
+	}
+}
+
+// getFailedTargets returns the databases whose last migration, or rollback, of the current generation failed.
+// They stay failed while they are retried, until a run succeeds.
+func getFailedTargets(migration *flywayv1alpha1.Migration) []string {
+	last := map[string]flywayv1alpha1.HistoryEntry{}
+	for _, entry := range migration.Status.History {
+		if entry.Action == actionMigrate || entry.Action == actionRollback {
+			last[entry.Target] = entry
+		}
+	}
+
+	return lo.FilterMap(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus, _ int) (string, bool) {
+		entry, found := last[status.Name]
+		return status.Name, found && entry.Result == flywayv1alpha1.TargetFailed && entry.Generation == migration.Generation
+	})
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"github.com/redhat-cop/operator-utils/pkg/util/apis"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// getConditionStatus returns the status of the condition, empty when it is not set
+func getConditionStatus(migration *flywayv1alpha1.Migration, conditionType string) metav1.ConditionStatus {
+	condition := meta.FindStatusCondition(migration.Status.Conditions, conditionType)
+	if condition == nil {
+		return ""
+	}
+	return condition.Status
+}
+
+func TestSetHealthConditions(t *testing.T) {
+	ready := func(status metav1.ConditionStatus, generation int64) metav1.Condition {
+		return metav1.Condition{Type: flywayv1alpha1.ConditionReady, Status: status, ObservedGeneration: generation,
+			Reason: "Progressing", Message: "0 of 1 databases migrated"}
+	}
+	targets := []flywayv1alpha1.TargetStatus{{Name: "default"}}
+
+	for name, test := range map[string]struct {
+		annotations map[string]string
+		status      flywayv1alpha1.MigrationStatus
+		issue       error
+		ready       metav1.ConditionStatus
+		reconciling metav1.ConditionStatus
+		stalled     metav1.ConditionStatus
+	}{
+		"ready": {
+			status: flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{ready(metav1.ConditionTrue, 2)}, Targets: targets},
+			ready:  metav1.ConditionTrue,
+		},
+		"progressing": {
+			status:      flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{ready(metav1.ConditionFalse, 2)}, Targets: targets},
+			ready:       metav1.ConditionFalse,
+			reconciling: metav1.ConditionTrue,
+		},
+		"ready for an earlier generation": {
+			status:      flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{ready(metav1.ConditionTrue, 1)}, Targets: targets},
+			ready:       metav1.ConditionFalse,
+			reconciling: metav1.ConditionTrue,
+		},
+		"paused": {
+			annotations: map[string]string{flywayv1alpha1.Paused: "true"},
+			status:      flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{ready(metav1.ConditionFalse, 2)}, Targets: targets},
+			ready:       metav1.ConditionFalse,
+		},
+		"failed": {
+			status: flywayv1alpha1.MigrationStatus{
+				Conditions: []metav1.Condition{ready(metav1.ConditionFalse, 2)},
+				Targets:    targets,
+				History:    []flywayv1alpha1.HistoryEntry{{Action: actionMigrate, Target: "default", Generation: 2, Result: flywayv1alpha1.TargetFailed}},
+			},
+			ready:   metav1.ConditionFalse,
+			stalled: metav1.ConditionTrue,
+		},
+		"failed at an earlier generation": {
+			status: flywayv1alpha1.MigrationStatus{
+				Conditions: []metav1.Condition{ready(metav1.ConditionFalse, 2)},
+				Targets:    targets,
+				History:    []flywayv1alpha1.HistoryEntry{{Action: actionMigrate, Target: "default", Generation: 1, Result: flywayv1alpha1.TargetFailed}},
+			},
+			ready:       metav1.ConditionFalse,
+			reconciling: metav1.ConditionTrue,
+		},
+		"succeeded after failing": {
+			status: flywayv1alpha1.MigrationStatus{
+				Conditions: []metav1.Condition{ready(metav1.ConditionTrue, 2)},
+				Targets:    targets,
+				History: []flywayv1alpha1.HistoryEntry{
+					{Action: actionMigrate, Target: "default", Generation: 2, Result: flywayv1alpha1.TargetFailed},
+					{Action: actionMigrate, Target: "default", Generation: 2, Result: flywayv1alpha1.TargetSucceeded},
+				},
+			},
+			ready: metav1.ConditionTrue,
+		},
+		"reconcile failed": {
+			status: flywayv1alpha1.MigrationStatus{
+				Conditions: []metav1.Condition{ready(metav1.ConditionTrue, 2), {Type: apis.ReconcileSuccess, Status: metav1.ConditionTrue}},
+				Targets:    targets,
+			},
+			issue:   errors.New("some error"),
+			ready:   metav1.ConditionTrue,
+			stalled: metav1.ConditionTrue,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			migration := &flywayv1alpha1.Migration{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2, Annotations: test.annotations},
+				Status:     test.status,
+			}
+			setHealthConditions(migration, test.issue)
+
+			testhelper.AssertEquals(t, int64(2), migration.Status.ObservedGeneration)
+			testhelper.AssertEquals(t, test.ready, getConditionStatus(migration, flywayv1alpha1.ConditionReady))
+			testhelper.AssertEquals(t, test.reconciling, getConditionStatus(migration, flywayv1alpha1.ConditionReconciling))
+			testhelper.AssertEquals(t, test.stalled, getConditionStatus(migration, flywayv1alpha1.ConditionStalled))
+			testhelper.AssertEquals(t, metav1.ConditionStatus(""), getConditionStatus(migration, apis.ReconcileSuccess))
+		})
+	}
+}
+
+func TestReconcileHealthConditions(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace", Generation: 1},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, updated.Generation, updated.Status.ObservedGeneration)
+	testhelper.AssertEquals(t, metav1.ConditionTrue, getConditionStatus(updated, flywayv1alpha1.ConditionReconciling))
+	testhelper.AssertEquals(t, metav1.ConditionStatus(""), getConditionStatus(updated, apis.ReconcileSuccess))
+}
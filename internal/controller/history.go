@@ -0,0 +1,83 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxHistory is the number of runs kept in the status
+const maxHistory = 10
+
+// isRecorded returns true if the outcome of the job has been recorded for the database. The history only holds the
+// most recent runs of all databases, so the job recorded last is kept per database and action.
+func isRecorded(migration *flywayv1alpha1.Migration, status *flywayv1alpha1.TargetStatus, job *batchv1.Job) bool {
+	if uid, found := status.RecordedJobs[getJobAction(job)]; found && uid == job.UID {
+		return true
+	}
+
+	return lo.ContainsBy(migration.Status.History, func(entry flywayv1alpha1.HistoryEntry) bool { return entry.JobUID == job.UID })
+}
+
+// recordHistory adds the outcome of a finished job to the history of the migration, unless it is already recorded.
+// It returns whether the job was recorded.
+func recordHistory(migration *flywayv1alpha1.Migration, status *flywayv1alpha1.TargetStatus, job *batchv1.Job) bool {
+	if isRecorded(migration, status, job) {
+		return false
+	}
+
+	entry := flywayv1alpha1.HistoryEntry{
+		Action:         getJobAction(job),
+		Target:         status.Name,
+		JobName:        job.Name,
+		JobUID:         job.UID,
+		Generation:     getJobGeneration(job),
+		Result:         flywayv1alpha1.TargetSucceeded,
+		StartTime:      job.Status.StartTime,
+		CompletionTime: getJobCompletionTime(job),
+	}
+	if hasFailed(job) {
+		entry.Result = flywayv1alpha1.TargetFailed
+		entry.Message = getJobFailure(job)
+	}
+
+	history := append(migration.Status.History, entry)
+	migration.Status.History = history[max(len(history)-maxHistory, 0):]
+	if status.RecordedJobs == nil {
+		status.RecordedJobs = map[string]types.UID{}
+	}
+	status.RecordedJobs[entry.Action] = job.UID
+	observeRun(migration, entry)
+
+	return true
+}
+
+// getJobCompletionTime returns when the finished job completed, or failed, if known.
+func getJobCompletionTime(job *batchv1.Job) *metav1.Time {
+	if condition, found := lo.Find(job.Status.Conditions, func(condition batchv1.JobCondition) bool {
+		return condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue
+	}); found {
+		return &condition.LastTransitionTime
+	}
+
+	return job.Status.CompletionTime
+}
@@ -2,7 +2,6 @@ package controller
 
 import (
 	"fmt"
-	"strconv"
 
 	"github.com/caitlinelfring/go-env-default"
 	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
@@ -16,6 +15,16 @@ import (
 const (
 	defaultFlywayImage = "docker.io/flyway/flyway:10"
 	envNameFlywayImage = "FLYWAY_IMAGE"
+
+	actionMigrate    = "migrate"
+	actionRollback   = "rollback"
+	actionRepair     = "repair"
+	actionDryRun     = "dryrun"
+	actionInfo       = "info"
+	actionDriftCheck = "driftcheck"
+
+	// copySqlContainerName copies the migrations from their image before flyway runs
+	copySqlContainerName = "copy-sql"
 )
 
 func jobIsCurrent(job *batchv1.Job, migration *flywayv1alpha1.Migration) bool {
@@ -45,55 +54,108 @@ func getFlywayImage(migration *flywayv1alpha1.Migration) string {
 }
 
 func getFlywayArgs(migration *flywayv1alpha1.Migration) []string {
-	args := migration.Spec.FlywayConfiguration.Commands
-	args = append(args, "-outputType=json")
+	return getFlywayCommandArgs(migration.Spec.FlywayConfiguration.Commands...)
+}
 
-	jdbcProps := lo.MapToSlice(migration.Spec.FlywayConfiguration.JdbcProperties, func(key string, value string) string {
-		return fmt.Sprintf("-environments.default.jdbcProperties.%s=%s", key, value)
-	})
-	args = append(args, jdbcProps...)
+// getFlywayCommandArgs returns the args to run the commands with the rendered flyway.toml.
+func getFlywayCommandArgs(commands ...string) []string {
+	args := append([]string{}, commands...)
+	args = append(args, "-outputType=json", getFlywayConfigFileArg())
 
 	return args
 }
 
-func createJobSpec(migration *flywayv1alpha1.Migration) *batchv1.Job {
+func getFlywayConfigFileArg() string {
+	return fmt.Sprintf("-configFiles=%s/%s", flywayConfigMountPath, flywayConfigFileName)
+}
+
+// getJobAction returns what the job runs, jobs created before actions were introduced are migrations.
+func getJobAction(job *batchv1.Job) string {
+	action, _ := lo.Coalesce(job.Labels[flywayv1alpha1.Action], actionMigrate)
+	return action
+}
+
+func getLabels(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/managed-by": "flyway-operator",
+		"app.kubernetes.io/name":       "flyway",
+		"app.kubernetes.io/instance":   migration.Name,
+		flywayv1alpha1.TargetName:      target.Name,
+	}
+}
+
+// getJobNameParts returns the parts of the names of the jobs of the target, the migration and, unless the migration has
+// a single database, the target.
+func getJobNameParts(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, parts ...string) []string {
+	if migration.Spec.Database != nil {
+		return append([]string{migration.Name}, parts...)
+	}
+
+	return append([]string{migration.Name, target.Name}, parts...)
+}
+
+// getJobName returns the name of the job migrating the target.
+// A migration of a single database keeps the name of the migration.
+func getJobName(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) string {
+	if migration.Spec.Database != nil {
+		return migration.Name
+	}
+
+	return getName(getJobNameParts(migration, target)...)
+}
+
+// getActionJobName returns the name of the job running the action against the target.
+func getActionJobName(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, action string) string {
+	if action == actionMigrate {
+		return getJobName(migration, target)
+	}
+
+	return getName(getJobNameParts(migration, target, action)...)
+}
+
+// createActionJobSpec creates the job running the action against the target.
+func createActionJobSpec(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, action string) *batchv1.Job {
+	switch action {
+	case actionRollback:
+		return createRollbackJobSpec(migration, target)
+	case actionRepair:
+		return createCommandJobSpec(migration, target, actionRepair, "repair")
+	case actionDryRun:
+		return createDryRunJobSpec(migration, target)
+	case actionInfo:
+		return createCommandJobSpec(migration, target, actionInfo, "info")
+	case actionDriftCheck:
+		return createDriftCheckJobSpec(migration, target)
+	}
+
+	job := createJobSpec(migration, target)
+	pinApprovedSource(migration, job)
+	return job
+}
+
+// createCommandJobSpec creates a job running the commands of the action instead of the commands of the migration.
+func createCommandJobSpec(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, action string, commands ...string) *batchv1.Job {
+	job := createJobSpec(migration, target)
+	job.Name = getActionJobName(migration, target, action)
+	job.Labels[flywayv1alpha1.Action] = action
+	job.Spec.Template.Spec.Containers[0].Args = getFlywayCommandArgs(commands...)
+
+	return job
+}
+
+func createJobSpec(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) *batchv1.Job {
 	const targetPath = "/mnt/target/"
 	envVars := []corev1.EnvVar{
 		{
-			Name:  "FLYWAY_USER",
-			Value: migration.Spec.Database.Username,
-		},
-		{
-			Name: "FLYWAY_PASSWORD",
+			Name: passwordEnvVar,
 			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &(migration.Spec.Database).Credentials,
+				SecretKeyRef: &target.Credentials,
 			},
 		},
-		{
-			Name:  "FLYWAY_URL",
-			Value: migration.Spec.Database.JdbcUrl,
-		},
-		{
-			Name:  "FLYWAY_ENCODING",
-			Value: migration.Spec.MigrationSource.Encoding,
-		},
-	}
-
-	if migration.Spec.FlywayConfiguration.BaselineOnMigrate != nil {
-		envVars = append(envVars, corev1.EnvVar{
-			Name:  "FLYWAY_BASELINE_ON_MIGRATE",
-			Value: strconv.FormatBool(*migration.Spec.FlywayConfiguration.BaselineOnMigrate),
-		})
-	}
-
-	if migration.Spec.FlywayConfiguration.DefaultSchema != nil {
-		envVars = append(envVars, corev1.EnvVar{
-			Name:  "FLYWAY_DEFAULT_SCHEMA",
-			Value: *migration.Spec.FlywayConfiguration.DefaultSchema,
-		})
 	}
 	envVars = append(envVars, migration.Spec.FlywayConfiguration.EnvVars...)
-	envVars = append(envVars, migration.Spec.MigrationSource.GetPlaceholdersAsEnvVars()...)
+	labels := getLabels(migration, target)
+	labels[flywayv1alpha1.Action] = actionMigrate
 
 	job := &batchv1.Job{
 		TypeMeta: metav1.TypeMeta{
@@ -101,13 +163,9 @@ func createJobSpec(migration *flywayv1alpha1.Migration) *batchv1.Job {
 			APIVersion: batchv1.SchemeGroupVersion.String(),
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      migration.Name,
+			Name:      getJobName(migration, target),
 			Namespace: migration.Namespace,
-			Labels: map[string]string{
-				"app.kubernetes.io/managed-by": "flyway-operator",
-				"app.kubernetes.io/name":       "flyway",
-				"app.kubernetes.io/instance":   migration.Name,
-			},
+			Labels:    labels,
 			Annotations: map[string]string{
 				flywayv1alpha1.Generation: migration.GenerationAsString(),
 			},
@@ -118,7 +176,7 @@ func createJobSpec(migration *flywayv1alpha1.Migration) *batchv1.Job {
 				Spec: corev1.PodSpec{
 					InitContainers: []corev1.Container{
 						{
-							Name:            "copy-sql",
+							Name:            copySqlContainerName,
 							Image:           migration.Spec.MigrationSource.ImageRef,
 							ImagePullPolicy: corev1.PullAlways,
 							Command:         []string{"sh", "-c"},
@@ -133,7 +191,7 @@ func createJobSpec(migration *flywayv1alpha1.Migration) *batchv1.Job {
 					},
 					Containers: []corev1.Container{
 						{
-							Name:            "flyway",
+							Name:            flywayContainerName,
 							Image:           getFlywayImage(migration),
 							ImagePullPolicy: corev1.PullAlways,
 							Args:            getFlywayArgs(migration),
@@ -141,7 +199,12 @@ func createJobSpec(migration *flywayv1alpha1.Migration) *batchv1.Job {
 							VolumeMounts: append([]corev1.VolumeMount{
 								{
 									Name:      sqlVolumeName,
-									MountPath: "/flyway/sql",
+									MountPath: flywaySqlPath,
+								},
+								{
+									Name:      flywayConfigVolumeName,
+									MountPath: flywayConfigMountPath,
+									ReadOnly:  true,
 								},
 							}, migration.Spec.FlywayConfiguration.VolumeMounts...),
 						},
@@ -153,6 +216,14 @@ func createJobSpec(migration *flywayv1alpha1.Migration) *batchv1.Job {
 								EmptyDir: &corev1.EmptyDirVolumeSource{},
 							},
 						},
+						{
+							Name: flywayConfigVolumeName,
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: getJobName(migration, target)},
+								},
+							},
+						},
 					}, migration.Spec.FlywayConfiguration.Volumes...),
 					ImagePullSecrets: migration.Spec.MigrationSource.ImagePullSecrets,
 					RestartPolicy:    corev1.RestartPolicyNever,
@@ -1,11 +1,13 @@
 package controller
 
 import (
-	"strconv"
 	"testing"
 
 	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"github.com/samber/lo"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestCreateJobSpec(t *testing.T) {
@@ -18,7 +20,7 @@ func TestCreateJobSpec(t *testing.T) {
 			name: "basic config",
 			migration: flywayv1alpha1.Migration{
 				Spec: flywayv1alpha1.MigrationSpec{
-					Database: flywayv1alpha1.Database{
+					Database: &flywayv1alpha1.Database{
 						Username: "testuser",
 						Credentials: corev1.SecretKeySelector{
 							LocalObjectReference: corev1.LocalObjectReference{Name: "db-secret"},
@@ -26,52 +28,25 @@ func TestCreateJobSpec(t *testing.T) {
 						},
 						JdbcUrl: "jdbc:testurl",
 					},
-					FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{},
-					MigrationSource: flywayv1alpha1.MigrationSource{
-						Encoding: "UTF-8",
-					},
-				},
-			},
-			envAssertions: map[string]string{
-				"FLYWAY_USER":     "testuser",
-				"FLYWAY_URL":      "jdbc:testurl",
-				"FLYWAY_ENCODING": "UTF-8",
-			},
-		},
-		{
-			name: "baseline and schema",
-			migration: flywayv1alpha1.Migration{
-				Spec: flywayv1alpha1.MigrationSpec{
-					Database: flywayv1alpha1.Database{
-						Username: "user2",
-						Credentials: corev1.SecretKeySelector{
-							LocalObjectReference: corev1.LocalObjectReference{Name: "secret2"},
-							Key:                  "pass2",
-						},
-						JdbcUrl: "jdbc:url2",
-					},
 					FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
-						BaselineOnMigrate: func() *bool { b := true; return &b }(),
-						DefaultSchema:     func() *string { s := "myschema"; return &s }(),
+						EnvVars: []corev1.EnvVar{
+							{Name: "FLYWAY_LICENSE_KEY", Value: "somekey"},
+						},
 					},
 					MigrationSource: flywayv1alpha1.MigrationSource{
-						Encoding: "ISO-8859-1",
+						Encoding: "UTF-8",
 					},
 				},
 			},
 			envAssertions: map[string]string{
-				"FLYWAY_USER":                "user2",
-				"FLYWAY_URL":                 "jdbc:url2",
-				"FLYWAY_ENCODING":            "ISO-8859-1",
-				"FLYWAY_BASELINE_ON_MIGRATE": strconv.FormatBool(true),
-				"FLYWAY_DEFAULT_SCHEMA":      "myschema",
+				"FLYWAY_LICENSE_KEY": "somekey",
 			},
 		},
 		{
 			name: "volume and volumemount",
 			migration: flywayv1alpha1.Migration{
 				Spec: flywayv1alpha1.MigrationSpec{
-					Database: flywayv1alpha1.Database{
+					Database: &flywayv1alpha1.Database{
 						Username: "voluser",
 						Credentials: corev1.SecretKeySelector{
 							LocalObjectReference: corev1.LocalObjectReference{Name: "vol-secret"},
@@ -104,17 +79,13 @@ func TestCreateJobSpec(t *testing.T) {
 					},
 				},
 			},
-			envAssertions: map[string]string{
-				"FLYWAY_USER":     "voluser",
-				"FLYWAY_URL":      "jdbc:volurl",
-				"FLYWAY_ENCODING": "UTF-8",
-			},
+			envAssertions: map[string]string{},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			job := createJobSpec(&tt.migration)
+			job := createJobSpec(&tt.migration, tt.migration.GetTargets()[0])
 			if job == nil {
 				t.Fatalf("createJobSpec returned nil")
 			}
@@ -123,6 +94,18 @@ func TestCreateJobSpec(t *testing.T) {
 				t.Fatalf("no containers in job spec")
 			}
 			env := container[0].Env
+			password, found := lo.Find(env, func(e corev1.EnvVar) bool { return e.Name == passwordEnvVar })
+			if !found || password.ValueFrom == nil || *password.ValueFrom.SecretKeyRef != tt.migration.GetTargets()[0].Credentials {
+				t.Errorf("env var %s not referencing the credentials secret", passwordEnvVar)
+			}
+			if !lo.Contains(container[0].Args, "-configFiles=/flyway/operator/flyway.toml") {
+				t.Errorf("config file not passed in args: %v", container[0].Args)
+			}
+			if !lo.ContainsBy(job.Spec.Template.Spec.Volumes, func(vol corev1.Volume) bool {
+				return vol.Name == flywayConfigVolumeName && vol.ConfigMap != nil && vol.ConfigMap.Name == tt.migration.Name
+			}) {
+				t.Errorf("expected configmap volume %s not found", flywayConfigVolumeName)
+			}
 			for k, v := range tt.envAssertions {
 				found := false
 				for _, e := range env {
@@ -166,3 +149,22 @@ func TestCreateJobSpec(t *testing.T) {
 		})
 	}
 }
+
+func TestGetJobName(t *testing.T) {
+	single := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "single"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{JdbcUrl: "jdbc:url"},
+		},
+	}
+	testhelper.AssertEquals(t, "single", getJobName(single, single.GetTargets()[0]))
+
+	multiple := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "multiple"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Databases: []flywayv1alpha1.DatabaseTarget{{Name: "tenant-a"}, {Name: "tenant-b"}},
+		},
+	}
+	testhelper.AssertEquals(t, "multiple-tenant-a-820c382f", getJobName(multiple, multiple.GetTargets()[0]))
+	testhelper.AssertEquals(t, "multiple-tenant-b-1358fc18", getJobName(multiple, multiple.GetTargets()[1]))
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// lockDuration is how long a lock is held after it was acquired when the job holding it cannot be found,
+	// as the job may be about to be created
+	lockDuration = time.Minute
+	// lockRetryInterval is how often a locked database is checked again
+	lockRetryInterval = 30 * time.Second
+	// concurrentHolder is the holder of a lock which was acquired concurrently
+	concurrentHolder = "a concurrent job"
+	// lockHolderNamespaceLabel is the namespace of the migration holding a lock, which is named by the instance label
+	lockHolderNamespaceLabel = flywayv1alpha1.Prefix + "/" + "holder-namespace"
+)
+
+//+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;delete
+
+// getLockName returns the name of the lease locking the database of the target, identified by its jdbcUrl and the schema
+// holding the schema history table. Parameters of the jdbcUrl are ignored, they do not change the database.
+func getLockName(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) string {
+	url, _, _ := strings.Cut(target.JdbcUrl, "?")
+	url = strings.TrimRight(strings.ToLower(url), "/")
+	schema := lo.FromPtr(migration.Spec.FlywayConfiguration.DefaultSchema)
+	if schema == "" && len(migration.Spec.FlywayConfiguration.Schemas) > 0 {
+		schema = migration.Spec.FlywayConfiguration.Schemas[0]
+	}
+	hash := sha256.Sum256([]byte(url + "#" + strings.ToLower(schema)))
+
+	return "flyway-lock-" + hex.EncodeToString(hash[:])[:16]
+}
+
+// getLockKey returns where the lease locking the database of the target is kept, in the lock namespace,
+// or in the namespace of the migration when it is not set.
+func getLockKey(lockNamespace string, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) client.ObjectKey {
+	return client.ObjectKey{Namespace: lo.CoalesceOrEmpty(lockNamespace, migration.Namespace), Name: getLockName(migration, target)}
+}
+
+// getLockLabels returns the labels of a lease held by a job of the migration, which find the leases left behind
+// when the migration is deleted.
+func getLockLabels(namespace string, name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/managed-by": "flyway-operator",
+		"app.kubernetes.io/instance":   name,
+		lockHolderNamespaceLabel:       namespace,
+	}
+}
+
+// acquireLock locks the database of the target for the job, unless it is locked by another job which is still active.
+// It returns the holder of the lock when the database is locked, and an empty string when the lock was acquired.
+// The leases are kept in the lock namespace, or in the namespace of the migration when it is not set.
+func acquireLock(ctx context.Context, c client.Client, lockNamespace string, migration *flywayv1alpha1.Migration,
+	target flywayv1alpha1.DatabaseTarget, jobName string) (string, error) {
+	identity := fmt.Sprintf("%s/%s", migration.Namespace, jobName)
+	now := metav1.NewMicroTime(time.Now())
+	lease := &coordinationv1.Lease{}
+	key := getLockKey(lockNamespace, migration, target)
+
+	err := c.Get(ctx, key, lease)
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, Labels: getLockLabels(migration.Namespace, migration.Name)},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: ptr.To(int32(lockDuration.Seconds())),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		err = c.Create(ctx, lease)
+		if apierrors.IsAlreadyExists(err) {
+			return concurrentHolder, nil
+		}
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	holder := lo.FromPtr(lease.Spec.HolderIdentity)
+	if holder != identity && holder != "" {
+		held, err := isLockHeld(ctx, c, lease, now.Time)
+		if err != nil || held {
+			return holder, err
+		}
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Labels = getLockLabels(migration.Namespace, migration.Name)
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.RenewTime = &now
+	err = c.Update(ctx, lease)
+	if apierrors.IsConflict(err) {
+		return concurrentHolder, nil
+	}
+
+	return "", err
+}
+
+// releaseLock deletes the lease locking the database of the target once the job holding it has finished.
+// A lease which has been acquired by another job since is kept.
+func releaseLock(ctx context.Context, c client.Client, lockNamespace string, migration *flywayv1alpha1.Migration,
+	target flywayv1alpha1.DatabaseTarget, jobName string) error {
+	lease := &coordinationv1.Lease{}
+	err := c.Get(ctx, getLockKey(lockNamespace, migration, target), lease)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if lo.FromPtr(lease.Spec.HolderIdentity) != fmt.Sprintf("%s/%s", migration.Namespace, jobName) {
+		return nil
+	}
+
+	return deleteLease(ctx, c, lease)
+}
+
+// releaseLocks deletes the leases still held by the jobs of a deleted migration, whose jobs are deleted along with it.
+func releaseLocks(ctx context.Context, c client.Client, lockNamespace string, migration client.ObjectKey) error {
+	leases := &coordinationv1.LeaseList{}
+	err := c.List(ctx, leases, client.InNamespace(lo.CoalesceOrEmpty(lockNamespace, migration.Namespace)),
+		client.MatchingLabels(getLockLabels(migration.Namespace, migration.Name)))
+	if err != nil {
+		return err
+	}
+	for i := range leases.Items {
+		if err := deleteLease(ctx, c, &leases.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteLease deletes the lease unless it has changed since it was read, as it may have been acquired by another job.
+func deleteLease(ctx context.Context, c client.Client, lease *coordinationv1.Lease) error {
+	err := c.Delete(ctx, lease, client.Preconditions{ResourceVersion: &lease.ResourceVersion})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return nil
+	}
+
+	return err
+}
+
+// isLockHeld returns true if the job holding the lock is active, or has not been found shortly after acquiring it.
+func isLockHeld(ctx context.Context, c client.Client, lease *coordinationv1.Lease, now time.Time) (bool, error) {
+	namespace, name, _ := strings.Cut(lo.FromPtr(lease.Spec.HolderIdentity), "/")
+	job := &batchv1.Job{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, job)
+	if apierrors.IsNotFound(err) {
+		return lease.Spec.RenewTime != nil && now.Before(lease.Spec.RenewTime.Add(lockDuration)), nil
+	}
+
+	return err == nil && !isJobFinished(job), err
+}
+
+// setWaitingForLockCondition reports the targets waiting for the lock of their database.
+func setWaitingForLockCondition(migration *flywayv1alpha1.Migration, locked []string) {
+	condition := metav1.Condition{
+		Type:               flywayv1alpha1.ConditionWaitingForLock,
+		ObservedGeneration: migration.Generation,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NotLocked",
+		Message:            "no database is locked by another job",
+	}
+	if len(locked) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "DatabaseLocked"
+		condition.Message = fmt.Sprintf("waiting for the lock of %s", strings.Join(locked, ", "))
+	}
+	meta.SetStatusCondition(&migration.Status.Conditions, condition)
+}
+
+// setTargetWaitingForLock flags the target as waiting for the lock of its database.
+func setTargetWaitingForLock(statuses []flywayv1alpha1.TargetStatus, target flywayv1alpha1.DatabaseTarget, holder string) {
+	for i := range statuses {
+		if statuses[i].Name == target.Name {
+			statuses[i].Message = fmt.Sprintf("waiting for the lock of the database, held by %s", holder)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestGetLockName(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{}
+	target := func(jdbcUrl string) flywayv1alpha1.DatabaseTarget {
+		return flywayv1alpha1.DatabaseTarget{Database: flywayv1alpha1.Database{JdbcUrl: jdbcUrl}}
+	}
+	name := getLockName(migration, target("jdbc:postgresql://somehost/somedb"))
+
+	testhelper.AssertEquals(t, name, getLockName(migration, target("jdbc:postgresql://SomeHost/somedb/?sslmode=require")))
+	testhelper.CheckEquals(t, true, name != getLockName(migration, target("jdbc:postgresql://somehost/otherdb")))
+	migration.Spec.FlywayConfiguration.DefaultSchema = ptr.To("someschema")
+	testhelper.CheckEquals(t, true, name != getLockName(migration, target("jdbc:postgresql://somehost/somedb")))
+}
+
+func TestReconcileWaitingForLock(t *testing.T) {
+	newMigration := func(name string) *flywayv1alpha1.Migration {
+		return &flywayv1alpha1.Migration{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "some-namespace"},
+			Spec: flywayv1alpha1.MigrationSpec{
+				Database: &flywayv1alpha1.Database{
+					Username: "someUser",
+					JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+				},
+				MigrationSource: flywayv1alpha1.MigrationSource{
+					ImageRef: "somereg.io/someimage:sometag",
+				},
+			},
+		}
+	}
+	first := newMigration("first-migration")
+	second := newMigration("second-migration")
+
+	ctx := context.TODO()
+	r := newTestReconciler(first, second)
+	r.LockNamespace = "flyway-operator-system"
+	firstReq := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: first.Namespace, Name: first.Name}}
+	secondReq := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: second.Namespace, Name: second.Name}}
+
+	_, err := r.Reconcile(ctx, firstReq)
+	testhelper.AssertNoErr(t, err)
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(first), job))
+
+	result, err := r.Reconcile(ctx, secondReq)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, lockRetryInterval, result.RequeueAfter)
+	err = r.GetClient().Get(ctx, client.ObjectKeyFromObject(second), &batchv1.Job{})
+	testhelper.AssertEquals(t, true, err != nil)
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, secondReq.NamespacedName, updated))
+	condition := meta.FindStatusCondition(updated.Status.Conditions, flywayv1alpha1.ConditionWaitingForLock)
+	testhelper.AssertEquals(t, metav1.ConditionTrue, condition.Status)
+	testhelper.AssertEquals(t, "waiting for the lock of default, held by some-namespace/first-migration", condition.Message)
+
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, secondReq)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(second), &batchv1.Job{}))
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, secondReq.NamespacedName, updated))
+	testhelper.AssertEquals(t, false, meta.IsStatusConditionTrue(updated.Status.Conditions, flywayv1alpha1.ConditionWaitingForLock))
+}
+
+func TestReleaseLock(t *testing.T) {
+	newMigration := func(name string) *flywayv1alpha1.Migration {
+		return &flywayv1alpha1.Migration{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "some-namespace"},
+			Spec: flywayv1alpha1.MigrationSpec{
+				Database: &flywayv1alpha1.Database{
+					Username: "someUser",
+					JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+				},
+				MigrationSource: flywayv1alpha1.MigrationSource{
+					ImageRef: "somereg.io/someimage:sometag",
+				},
+			},
+		}
+	}
+	first := newMigration("first-migration")
+	second := newMigration("second-migration")
+
+	ctx := context.TODO()
+	r := newTestReconciler(first, second)
+	r.LockNamespace = "flyway-operator-system"
+	key := getLockKey(r.LockNamespace, first, first.GetTargets()[0])
+	firstReq := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(first)}
+	secondReq := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(second)}
+
+	_, err := r.Reconcile(ctx, firstReq)
+	testhelper.AssertNoErr(t, err)
+	lease := &coordinationv1.Lease{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, key, lease))
+
+	// a lease acquired by another job is kept
+	testhelper.AssertNoErr(t, releaseLock(ctx, r.GetClient(), r.LockNamespace, second, second.GetTargets()[0], second.Name))
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, key, lease))
+
+	// the lease is deleted once the job holding it has finished
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(first), job))
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	_, err = r.Reconcile(ctx, firstReq)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, apierrors.IsNotFound(r.GetClient().Get(ctx, key, lease)))
+
+	// the lease held by a deleted migration is deleted along with it
+	_, err = r.Reconcile(ctx, secondReq)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, key, lease))
+	testhelper.AssertEquals(t, "some-namespace/second-migration", *lease.Spec.HolderIdentity)
+	_, err = r.Reconcile(ctx, firstReq)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, key, lease))
+	testhelper.AssertNoErr(t, r.GetClient().Delete(ctx, second))
+	_, err = r.Reconcile(ctx, secondReq)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, apierrors.IsNotFound(r.GetClient().Get(ctx, key, lease)))
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	driftedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flyway_migration_drifted",
+		Help: "Whether the last drift check of the migration found drift, 1 when drifted, 0 when not.",
+	}, []string{"namespace", "migration"})
+	runsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "flyway_migration_runs_total",
+		Help: "Number of finished flyway jobs of the migration, by action and result.",
+	}, []string{"namespace", "migration", "action", "result"})
+	durationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "flyway_migration_duration_seconds",
+		Help:    "Duration of the finished flyway jobs of the migration, by action.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"namespace", "migration", "action"})
+	schemaVersionGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flyway_schema_version",
+		Help: "The schema version of each database of the migration, as reported by flyway, always 1.",
+	}, []string{"namespace", "migration", "target", "version"})
+	pendingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flyway_pending_migrations",
+		Help: "Number of migrations pending on each database of the migration.",
+	}, []string{"namespace", "migration", "target"})
+	lastSuccessGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flyway_migration_last_success_timestamp",
+		Help: "Unix time the last successful migrate job of the migration completed, as far as kept in its history.",
+	}, []string{"namespace", "migration"})
+	failedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flyway_migration_failed",
+		Help: "Whether the jobs of the migration failed on any of its databases, 1 when failed, 0 when not.",
+	}, []string{"namespace", "migration"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(driftedGauge, runsCounter, durationHistogram, schemaVersionGauge, pendingGauge,
+		lastSuccessGauge, failedGauge)
+}
+
+// observeRun counts a run once it is recorded in the history of the migration.
+func observeRun(migration *flywayv1alpha1.Migration, entry flywayv1alpha1.HistoryEntry) {
+	runsCounter.WithLabelValues(migration.Namespace, migration.Name, entry.Action, strings.ToLower(string(entry.Result))).Inc()
+	if entry.StartTime != nil && entry.CompletionTime != nil {
+		durationHistogram.WithLabelValues(migration.Namespace, migration.Name, entry.Action).
+			Observe(entry.CompletionTime.Sub(entry.StartTime.Time).Seconds())
+	}
+}
+
+// setMigrationMetrics sets the gauges of the migration from its status.
+func setMigrationMetrics(migration *flywayv1alpha1.Migration) {
+	labels := prometheus.Labels{"namespace": migration.Namespace, "migration": migration.Name}
+	// databases which were removed or have changed version are dropped
+	schemaVersionGauge.DeletePartialMatch(labels)
+	pendingGauge.DeletePartialMatch(labels)
+	for _, status := range migration.Status.Targets {
+		if status.CurrentVersion != "" {
+			schemaVersionGauge.WithLabelValues(migration.Namespace, migration.Name, status.Name, status.CurrentVersion).Set(1)
+		}
+		pendingGauge.WithLabelValues(migration.Namespace, migration.Name, status.Name).Set(float64(len(status.PendingMigrations)))
+	}
+
+	successes := lo.Filter(migration.Status.History, func(entry flywayv1alpha1.HistoryEntry, _ int) bool {
+		return entry.Action == actionMigrate && entry.Result == flywayv1alpha1.TargetSucceeded && entry.CompletionTime != nil
+	})
+	if len(successes) > 0 {
+		last := lo.MaxBy(successes, func(a, b flywayv1alpha1.HistoryEntry) bool { return a.CompletionTime.After(b.CompletionTime.Time) })
+		lastSuccessGauge.With(labels).Set(float64(last.CompletionTime.Unix()))
+	}
+
+	failed := lo.ContainsBy(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) bool {
+		return status.Phase == flywayv1alpha1.TargetFailed
+	})
+	failedGauge.With(labels).Set(float64(lo.Ternary(failed, 1, 0)))
+}
+
+// deleteMigrationMetrics drops the metrics of a deleted migration.
+func deleteMigrationMetrics(namespace string, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "migration": name}
+	for _, vec := range []*prometheus.MetricVec{driftedGauge.MetricVec, runsCounter.MetricVec, durationHistogram.MetricVec,
+		schemaVersionGauge.MetricVec, pendingGauge.MetricVec, lastSuccessGauge.MetricVec, failedGauge.MetricVec} {
+		vec.DeletePartialMatch(labels)
+	}
+}
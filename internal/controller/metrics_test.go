@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMigrationMetrics(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "metrics-migration", Namespace: "some-namespace"},
+	}
+	status := &flywayv1alpha1.TargetStatus{Name: "tenant-a"}
+	start := metav1.NewTime(time.Unix(1700000000, 0))
+	completion := metav1.NewTime(start.Add(90 * time.Second))
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "metrics-migration-tenant-a", UID: "some-uid"},
+		Status: batchv1.JobStatus{
+			Succeeded:      1,
+			StartTime:      &start,
+			CompletionTime: &completion,
+			Conditions:     []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+
+	// runs are counted once
+	testhelper.AssertEquals(t, true, recordHistory(migration, status, job))
+	testhelper.AssertEquals(t, false, recordHistory(migration, status, job))
+	testhelper.AssertEquals(t, float64(1), testutil.ToFloat64(runsCounter.WithLabelValues(migration.Namespace, migration.Name, actionMigrate, "succeeded")))
+	duration := &dto.Metric{}
+	testhelper.AssertNoErr(t, durationHistogram.WithLabelValues(migration.Namespace, migration.Name, actionMigrate).(prometheus.Histogram).Write(duration))
+	testhelper.AssertEquals(t, uint64(1), duration.GetHistogram().GetSampleCount())
+	testhelper.AssertEquals(t, float64(90), duration.GetHistogram().GetSampleSum())
+
+	migration.Status.Targets = []flywayv1alpha1.TargetStatus{
+		{Name: "tenant-a", Phase: flywayv1alpha1.TargetSucceeded, CurrentVersion: "1.1", PendingMigrations: []string{"1.2", "1.3"}},
+		{Name: "tenant-b", Phase: flywayv1alpha1.TargetFailed},
+	}
+	setMigrationMetrics(migration)
+	testhelper.AssertEquals(t, float64(1), testutil.ToFloat64(schemaVersionGauge.WithLabelValues(migration.Namespace, migration.Name, "tenant-a", "1.1")))
+	testhelper.AssertEquals(t, float64(2), testutil.ToFloat64(pendingGauge.WithLabelValues(migration.Namespace, migration.Name, "tenant-a")))
+	testhelper.AssertEquals(t, float64(completion.Unix()), testutil.ToFloat64(lastSuccessGauge.WithLabelValues(migration.Namespace, migration.Name)))
+	testhelper.AssertEquals(t, float64(1), testutil.ToFloat64(failedGauge.WithLabelValues(migration.Namespace, migration.Name)))
+
+	// the version of a database is reported once
+	migration.Status.Targets[0].CurrentVersion = "1.3"
+	migration.Status.Targets[1].Phase = flywayv1alpha1.TargetSucceeded
+	setMigrationMetrics(migration)
+	testhelper.AssertEquals(t, false, schemaVersionGauge.DeleteLabelValues(migration.Namespace, migration.Name, "tenant-a", "1.1"))
+	testhelper.AssertEquals(t, float64(1), testutil.ToFloat64(schemaVersionGauge.WithLabelValues(migration.Namespace, migration.Name, "tenant-a", "1.3")))
+	testhelper.AssertEquals(t, float64(0), testutil.ToFloat64(failedGauge.WithLabelValues(migration.Namespace, migration.Name)))
+
+	deleteMigrationMetrics(migration.Namespace, migration.Name)
+	labels := prometheus.Labels{"namespace": migration.Namespace, "migration": migration.Name}
+	testhelper.AssertEquals(t, 0, schemaVersionGauge.DeletePartialMatch(labels))
+	testhelper.AssertEquals(t, 0, runsCounter.DeletePartialMatch(labels))
+}
+
+func TestRunsCountedOnceBeyondHistory(t *testing.T) {
+	databases := make([]flywayv1alpha1.DatabaseTarget, maxHistory+2)
+	for i := range databases {
+		name := fmt.Sprintf("tenant-%d", i)
+		databases[i] = flywayv1alpha1.DatabaseTarget{
+			Name:     name,
+			Database: flywayv1alpha1.Database{Username: "someUser", JdbcUrl: "jdbc:postgresql://somehost/" + name},
+		}
+	}
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "many-databases", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Databases:       databases,
+			MaxConcurrency:  int32(len(databases)),
+			MigrationSource: flywayv1alpha1.MigrationSource{ImageRef: "somereg.io/someimage:sometag"},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	jobs := &batchv1.JobList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(migration.Namespace)))
+	testhelper.AssertEquals(t, len(databases), len(jobs.Items))
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		// the fake client does not assign UIDs, which tell the jobs apart
+		job.UID = types.UID(job.Name)
+		testhelper.AssertNoErr(t, r.GetClient().Update(ctx, job))
+		job.Status.Succeeded = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	}
+
+	// the runs evicted from the history are not recorded again
+	runs := func() float64 {
+		return testutil.ToFloat64(runsCounter.WithLabelValues(migration.Namespace, migration.Name, actionMigrate, "succeeded"))
+	}
+	updated := &flywayv1alpha1.Migration{}
+	var history []flywayv1alpha1.HistoryEntry
+	for i := range 3 {
+		_, err = r.Reconcile(ctx, req)
+		testhelper.AssertNoErr(t, err)
+		testhelper.AssertEquals(t, float64(len(databases)), runs())
+		testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+		testhelper.AssertEquals(t, maxHistory, len(updated.Status.History))
+		if i > 0 {
+			testhelper.AssertDeepEquals(t, history, updated.Status.History)
+		}
+		history = updated.Status.History
+	}
+}
@@ -20,19 +20,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/davidkarlsen/flyway-operator/internal/notification"
+	"github.com/davidkarlsen/flyway-operator/internal/tracing"
 	"github.com/redhat-cop/operator-utils/pkg/util"
 	"github.com/redhat-cop/operator-utils/pkg/util/crud"
+	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const (
@@ -45,9 +54,25 @@ type MigrationReconciler struct {
 	util.ReconcilerBase
 	client.Client
 	Scheme *runtime.Scheme
+	// CleanDisabledNamespaces are the namespaces in which flyway clean is never run, * disables clean in all namespaces
+	CleanDisabledNamespaces []string
+	// Recorder emits the events of the transitions of migrations
+	Recorder events.EventRecorder
+	// LogReader reads the output of finished jobs, the schema versions are not reported when not set
+	LogReader LogReader
+	// LockNamespace holds the leases locking the databases, the namespace of the migration is used when not set
+	LockNamespace string
+	// Notifier sends the notifications of the policies, posting to their webhooks when not set
+	Notifier notification.Notifier
+	// AllowPrivateReceivers allows the webhooks of notification policies on loopback, link-local and private addresses
+	AllowPrivateReceivers bool
+	// OperatorNamespace holds the secrets of the receivers of the cluster-scoped notification policies
+	OperatorNamespace string
 }
 
 //+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=migrations,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=migrations/status,verbs=get;update;patch
@@ -57,6 +82,15 @@ type MigrationReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
 func (r *MigrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("migration.namespace", req.Namespace), attribute.String("migration.name", req.Name)))
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+
+	return result, err
+}
+
+func (r *MigrationReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	// nolint:staticcheck // SA1029 ignore this!
 	ctx = context.WithValue(ctx, clientContextKey, r.GetClient())
 	logger := log.FromContext(ctx).WithValues("migration", req.NamespacedName)
@@ -64,61 +98,271 @@ func (r *MigrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	migration := &flywayv1alpha1.Migration{}
 
 	if err := r.Get(ctx, req.NamespacedName, migration); err != nil {
+		if apierrors.IsNotFound(err) {
+			deleteMigrationMetrics(req.Namespace, req.Name)
+			if err := releaseLocks(ctx, r.GetClient(), r.LockNamespace, req.NamespacedName); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
 		logger.Error(err, err.Error())
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
 	if util.IsBeingDeleted(migration) {
-		logger.Info("Migration deleted, returning")
-		r.GetRecorder().Event(migration, corev1.EventTypeWarning, "Deleting", fmt.Sprintf("Migration deleted: %s", req.NamespacedName))
-		return r.ManageSuccess(ctx, migration)
+		logger.Info("Migration deleted, scaling workloads back up")
+		if err := r.finalizeWorkloads(ctx, migration); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
 	}
 
+	// transitions are reported once the reconcile has made them
+	wasReady, previousVersion := migration.IsReady(), migration.Status.CurrentVersion
+
 	valid, err := r.IsValid(migration)
 	if !valid || err != nil {
-		return r.ManageError(ctx, migration, err)
+		return r.manageError(ctx, migration, err)
+	}
+
+	repairing, err := r.reconcileRepair(ctx, migration)
+	if err != nil {
+		return r.manageError(ctx, migration, err)
+	}
+	if repairing {
+		// the repair may wait for the lock of a database, which is not released by a job of this migration
+		logger.Info("Repair in progress - not creating flyway migration job.")
+		return r.manageSuccessWithRequeue(ctx, migration, lockRetryInterval)
 	}
 
-	if migration.IsPaused() {
+	if err := r.checkClean(migration); err != nil {
+		return r.manageError(ctx, migration, err)
+	}
+
+	r.reconcilePaused(migration, migration.IsPaused() && !migration.Spec.DryRun)
+	if migration.IsPaused() && !migration.Spec.DryRun {
 		logger.Info("Migration is paused - not creating flyway migration job.")
-		return r.ManageSuccess(ctx, migration)
+		return r.manageSuccess(ctx, migration)
 	}
 
-	existingJob, err := r.getExistingJob(ctx, migration)
+	targets, err := getTargets(ctx, &r.ReconcilerBase, migration)
 	if err != nil {
-		return r.ManageError(ctx, migration, err)
+		return r.manageError(ctx, migration, err)
+	}
+
+	if migration.Spec.Approval != nil && migration.Spec.Approval.Required && !isApprovalCurrent(migration, targets) {
+		// the databases found since the approval are checked for pending migrations, and approved, first
+		migration.Status.Approval = nil
+	}
+
+	// while a dry-run or rollback is requested, or approval is awaited, they are run instead of the flyway commands
+	action := actionMigrate
+	switch {
+	case migration.Spec.DryRun:
+		action = actionDryRun
+	case migration.Spec.Rollback != nil:
+		// the undo-scripts to run are planned from what info reports to be applied
+		action = lo.Ternary(isUndoScriptsRollback(migration) && !isUndoPlanned(migration, targets), actionInfo, actionRollback)
+	case !migration.IsApproved():
+		action = actionInfo
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("migration.generation", migration.Generation),
+		attribute.String("migration.action", action))
+
+	statuses := make([]flywayv1alpha1.TargetStatus, 0, len(targets))
+	var toSubmit []flywayv1alpha1.DatabaseTarget
+	retries := map[string]bool{}
+	// the runs recorded by the reconcile, which are notified of
+	var recorded []flywayv1alpha1.HistoryEntry
+	running := 0
+	for _, target := range targets {
+		jobName := getActionJobName(migration, target, action)
+		existingJob, err := r.getExistingJob(ctx, migration, jobName)
+		if err != nil {
+			return r.manageError(ctx, migration, err)
+		}
+		status := getTargetStatus(target, jobName, existingJob)
+		keepObservations(&status, getPreviousTargetStatus(migration, target))
+		if existingJob != nil && isJobFinished(existingJob) && !isRecorded(migration, &status, existingJob) {
+			// the job is only recorded once its output has been observed, so that observing is retried on errors
+			if status.Phase == flywayv1alpha1.TargetSucceeded {
+				if err := r.observeOutput(ctx, migration, target, existingJob, &status); err != nil {
+					return r.manageError(ctx, migration, err)
+				}
+			}
+			observeClean(migration, existingJob, &status)
+			if recordHistory(migration, &status, existingJob) {
+				if err := releaseLock(ctx, r.GetClient(), r.LockNamespace, migration, target, existingJob.Name); err != nil {
+					return r.manageError(ctx, migration, err)
+				}
+				recorded = append(recorded, migration.Status.History[len(migration.Status.History)-1])
+				r.traceJob(ctx, migration, target, existingJob)
+				if hasFailed(existingJob) {
+					r.recordJobFailed(migration, target, existingJob)
+				} else if action == actionMigrate || action == actionRollback {
+					r.observeSource(ctx, migration, existingJob)
+				}
+			}
+		}
+
+		switch {
+		case existingJob == nil: // no existing job - so submit one now
+			toSubmit = append(toSubmit, target)
+		case !isJobFinished(existingJob):
+			logger.Info("Job still running", "job", existingJob.Name)
+			if err := r.recordJobStarted(ctx, migration, target, existingJob); err != nil {
+				return r.manageError(ctx, migration, err)
+			}
+			running++
+		case action == actionRollback && hasFailed(existingJob) && jobIsCurrent(existingJob, migration):
+			logger.Info("Rollback failed, not retrying until the migration changes", "job", existingJob.Name)
+		case hasFailed(existingJob) || !jobIsCurrent(existingJob, migration): // failed or migration has changed - submit new job
+			toSubmit = append(toSubmit, target)
+			retries[target.Name] = hasFailed(existingJob) && jobIsCurrent(existingJob, migration)
+		case !hasSucceeded(existingJob):
+			err = fmt.Errorf("this is a bug and should not happen")
+			return r.manageError(ctx, migration, err)
+		}
+		statuses = append(statuses, status)
 	}
 
-	newJob := createJobSpec(migration)
+	unready, err := r.reconcileDependencies(ctx, migration)
+	if err != nil {
+		return r.manageError(ctx, migration, err)
+	}
+	if action == actionMigrate && len(unready) > 0 && len(toSubmit) > 0 {
+		logger.Info("Waiting for dependencies, postponing migration", "dependencies", unready)
+		setTargetsWaitingForDependencies(statuses, toSubmit, unready)
+		toSubmit = nil
+	}
 
-	if existingJob == nil { // no existing job - so submit one now
-		return r.submitMigrationJob(ctx, migration, newJob)
+	// changes to the databases wait for the schedule or maintenance windows of the migration
+	changing := action == actionMigrate || action == actionRollback
+	open, nextRun := true, time.Duration(0)
+	if changing {
+		open, nextRun, err = reconcileSchedule(migration, len(toSubmit) > 0, time.Now())
+		if err != nil {
+			return r.manageError(ctx, migration, err)
+		}
+		if !open {
+			logger.Info("Waiting for the schedule, postponing migration", "nextScheduledRun", migration.Status.NextScheduledRun)
+			setTargetsScheduled(statuses, migration, toSubmit)
+			toSubmit = nil
+		}
 	} else {
-		if !isJobFinished(existingJob) {
-			logger.Info("Job still running, returning for reconcile", "job", existingJob)
-			return r.ManageSuccess(ctx, migration)
+		migration.Status.NextScheduledRun = nil
+	}
+
+	// workloads are kept away from the databases while these are changed
+	nextWorkloadCheck := time.Duration(0)
+	if changing && len(migration.Spec.WorkloadRefs) > 0 && (running > 0 || len(toSubmit) > 0) {
+		down, err := r.scaleDownWorkloads(ctx, migration)
+		if err != nil {
+			return r.manageError(ctx, migration, err)
 		}
+		if !down && len(toSubmit) > 0 {
+			logger.Info("Waiting for workloads to scale down, postponing migration")
+			toSubmit = nil
+			open = false
+			nextWorkloadCheck = workloadRetryInterval
+		}
+	}
 
-		jobIsCurrent := jobIsCurrent(existingJob, migration)
+	// jobs of other migrations of the same database are not run concurrently, as they would contend for the flyway lock
+	capacity := int(max(migration.Spec.MaxConcurrency, 1)) - running
+	submitted := 0
+	var locked []string
+	for _, target := range toSubmit {
+		if submitted >= capacity {
+			logger.Info("Concurrency limit reached, postponing migration", "target", target.Name)
+			break
+		}
+		holder, err := acquireLock(ctx, r.GetClient(), r.LockNamespace, migration, target, getActionJobName(migration, target, action))
+		if err != nil {
+			return r.manageError(ctx, migration, err)
+		}
+		if holder != "" {
+			logger.Info("Database is locked, postponing migration", "target", target.Name, "holder", holder)
+			setTargetWaitingForLock(statuses, target, holder)
+			locked = append(locked, fmt.Sprintf("%s, held by %s", target.Name, holder))
+			continue
+		}
+		job := createActionJobSpec(migration, target, action)
+		skipClean(migration, statuses, target, job)
+		if err := r.submitMigrationJob(ctx, migration, target, job); err != nil {
+			return r.manageError(ctx, migration, err)
+		}
+		r.recordJobCreated(migration, target, job, retries[target.Name])
+		setTargetSubmitted(statuses, migration, target)
+		submitted++
+	}
+	setWaitingForLockCondition(migration, locked)
+	if open && submitted == len(toSubmit) {
+		// the planned run is done, a later change or retry is planned anew
+		migration.Status.NextScheduledRun = nil
+	}
 
-		if hasFailed(existingJob) || !jobIsCurrent {
-			return r.submitMigrationJob(ctx, migration, newJob)
+	migration.Status.Targets = statuses
+	if err := r.clearConfirmClean(ctx, migration); err != nil {
+		return r.manageError(ctx, migration, err)
+	}
+	setVersions(migration)
+	if action == actionInfo && migration.Spec.Rollback == nil {
+		pending, err := r.reconcileApproval(ctx, migration, targets)
+		if err != nil {
+			return r.manageError(ctx, migration, err)
 		}
+		if pending {
+			r.GetRecorder().Event(migration, corev1.EventTypeNormal, flywayv1alpha1.ConditionPendingApproval,
+				fmt.Sprintf("Pending migrations await approval, approve with the annotation %s=%s", flywayv1alpha1.Approve, migration.Status.Approval.Hash))
+		}
+	}
+	setApprovalCondition(migration)
+	setReadyCondition(migration, action)
+	if err := r.scaleUpWorkloads(ctx, migration, !changing || !isReady(migration)); err != nil {
+		return r.manageError(ctx, migration, err)
+	}
+	if err := r.setWorkloadsFinalizer(ctx, migration, len(migration.Status.ScaledDownWorkloads) > 0); err != nil {
+		return r.manageError(ctx, migration, err)
+	}
+	nextDriftCheck, err := r.reconcileDriftCheck(ctx, migration, targets)
+	if err != nil {
+		return r.manageError(ctx, migration, err)
+	}
+	setMigrationMetrics(migration)
 
-		if hasSucceeded(existingJob) {
-			if jobIsCurrent {
-				logger.Info("Migration succeeded")
-				r.GetRecorder().Event(migration, corev1.EventTypeNormal, "Succeeded",
-					fmt.Sprintf("Migration Succeeded: %s, source: %s", req.NamespacedName, migration.Spec.MigrationSource.ImageRef))
-				return r.ManageSuccess(ctx, migration)
-			} else { // migration has changed - submit new job
-				return r.submitMigrationJob(ctx, migration, newJob)
-			}
+	nextLockCheck := time.Duration(0)
+	if len(locked) > 0 {
+		nextLockCheck = lockRetryInterval
+	}
+
+	result, err := r.manageSuccessWithRequeue(ctx, migration, nextDriftCheck, nextRun, nextLockCheck, nextWorkloadCheck)
+	if err == nil {
+		// transitions are reported once persisted, a status which failed to update is reconciled anew
+		if isApplied(migration, action, wasReady) {
+			logger.Info("Migration applied", "currentVersion", migration.Status.CurrentVersion)
+			r.recordMigrationApplied(migration, action, previousVersion)
+		}
+		nextNotification, err := r.notify(ctx, migration, getNotifications(migration, action, wasReady, recorded))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if nextNotification > 0 && (result.RequeueAfter == 0 || nextNotification < result.RequeueAfter) {
+			result.RequeueAfter = nextNotification
 		}
 	}
 
-	err = fmt.Errorf("this is a bug and should not happen")
-	return r.ManageError(ctx, migration, err)
+	return result, err
+}
+
+// manageSuccessWithRequeue manages success, and requeues the migration after the shortest of the given durations, if any.
+func (r *MigrationReconciler) manageSuccessWithRequeue(ctx context.Context, migration *flywayv1alpha1.Migration, after ...time.Duration) (ctrl.Result, error) {
+	result, err := r.manageSuccess(ctx, migration)
+	positive := lo.Filter(after, func(duration time.Duration, _ int) bool { return duration > 0 })
+	if err == nil && len(positive) > 0 {
+		result.RequeueAfter = lo.Min(positive)
+	}
+
+	return result, err
 }
 
 // IsValid does validation of the CR
@@ -131,10 +375,78 @@ func (r *MigrationReconciler) IsValid(obj metav1.Object) (bool, error) {
 	return ok, nil
 }
 
-func (r *MigrationReconciler) getExistingJob(ctx context.Context, migration *flywayv1alpha1.Migration) (*batchv1.Job, error) {
+// checkClean guards against accidentally wiping a database with flyway clean.
+func (r *MigrationReconciler) checkClean(migration *flywayv1alpha1.Migration) error {
+	if !migration.HasCleanCommand() {
+		return nil
+	}
+	if lo.Contains(r.CleanDisabledNamespaces, "*") || lo.Contains(r.CleanDisabledNamespaces, migration.Namespace) {
+		return fmt.Errorf("clean is disabled in namespace %s", migration.Namespace)
+	}
+	if !migration.Spec.FlywayConfiguration.AllowClean {
+		return errors.New("clean is not allowed, set flywayConfiguration.allowClean to allow it")
+	}
+	if !migration.IsCleanConfirmed() && !isCleanCompleted(migration) {
+		return fmt.Errorf("clean is not confirmed, set the annotation %s to the current generation %s to confirm it",
+			flywayv1alpha1.ConfirmClean, migration.GenerationAsString())
+	}
+
+	return nil
+}
+
+// isCleanCompleted returns true if clean has been run for all databases at the current generation,
+// once it has, the confirmation is removed.
+func isCleanCompleted(migration *flywayv1alpha1.Migration) bool {
+	return len(migration.Status.Targets) > 0 && lo.EveryBy(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) bool {
+		return status.CleanedGeneration == migration.Generation
+	})
+}
+
+// observeClean records that the finished job of the current generation ran clean against the target. A failed job may
+// have failed after clean, so clean is considered to have run either way, and is not run again by the retries.
+func observeClean(migration *flywayv1alpha1.Migration, job *batchv1.Job, status *flywayv1alpha1.TargetStatus) {
+	if getJobAction(job) == actionMigrate && jobIsCurrent(job, migration) && lo.ContainsBy(job.Spec.Template.Spec.Containers[0].Args, isCleanCommand) {
+		status.CleanedGeneration = migration.Generation
+	}
+}
+
+// skipClean removes clean from the commands of the job when it has been run against the target at the current generation.
+func skipClean(migration *flywayv1alpha1.Migration, statuses []flywayv1alpha1.TargetStatus, target flywayv1alpha1.DatabaseTarget, job *batchv1.Job) {
+	status, _ := lo.Find(statuses, func(status flywayv1alpha1.TargetStatus) bool { return status.Name == target.Name })
+	if status.CleanedGeneration != migration.Generation {
+		return
+	}
+
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Args = lo.Reject(container.Args, func(arg string, _ int) bool { return isCleanCommand(arg) })
+}
+
+func isCleanCommand(command string) bool {
+	return strings.EqualFold(command, "clean")
+}
+
+// clearConfirmClean removes the confirmation of clean once clean has been run for all databases.
+// A copy is patched, so that the changes to the status of the migration are kept.
+func (r *MigrationReconciler) clearConfirmClean(ctx context.Context, migration *flywayv1alpha1.Migration) error {
+	if _, found := migration.Annotations[flywayv1alpha1.ConfirmClean]; !found || !isCleanCompleted(migration) {
+		return nil
+	}
+
+	cleared := migration.DeepCopy()
+	delete(cleared.Annotations, flywayv1alpha1.ConfirmClean)
+	if err := r.GetClient().Patch(ctx, cleared, client.MergeFrom(migration)); err != nil {
+		return err
+	}
+	migration.Annotations = cleared.Annotations
+	migration.ResourceVersion = cleared.ResourceVersion
+
+	return nil
+}
+
+func (r *MigrationReconciler) getExistingJob(ctx context.Context, migration *flywayv1alpha1.Migration, name string) (*batchv1.Job, error) {
 	// look for any current migration job and check state
 	existingJob := &batchv1.Job{}
-	err := r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), existingJob)
+	err := r.GetClient().Get(ctx, client.ObjectKey{Namespace: migration.Namespace, Name: name}, existingJob)
 	if apierrors.IsNotFound(err) {
 		return nil, nil
 	}
@@ -142,24 +454,38 @@ func (r *MigrationReconciler) getExistingJob(ctx context.Context, migration *fly
 	return existingJob, err
 }
 
-func (r *MigrationReconciler) submitMigrationJob(ctx context.Context, migration *flywayv1alpha1.Migration, job *batchv1.Job) (reconcile.Result, error) {
+// submitMigrationJob replaces any previous run of the job, along with the flyway configuration it mounts.
+// The job carries the trace of the submit, so that its lifecycle is traced along with it once it has finished.
+func (r *MigrationReconciler) submitMigrationJob(ctx context.Context, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, job *batchv1.Job) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "SubmitJob", trace.WithAttributes(append(migrationAttributes(migration),
+		attribute.String("migration.target", target.Name), attribute.String("job.name", job.Name))...))
+	defer func() { endSpan(span, err) }()
 	logger := log.FromContext(ctx)
 	//err := crud.DeleteResourceIfExists(ctx, job)
 	opts := metav1.DeletePropagationBackground
-	err := r.GetClient().Delete(ctx, job, &client.DeleteOptions{
+	err = r.GetClient().Delete(ctx, job, &client.DeleteOptions{
 		PropagationPolicy: &opts,
 	})
 	if err != nil && !apierrors.IsNotFound(err) {
-		return r.ManageError(ctx, migration, err)
+		return err
 	}
 
-	logger.Info("Creating job", "job", job)
-	err = crud.CreateResourceIfNotExists(ctx, migration, migration.Namespace, job)
+	configMap, err := createConfigMapSpec(migration, target)
 	if err != nil {
-		return r.ManageError(ctx, migration, err)
+		return err
 	}
 
-	return r.ManageSuccess(ctx, migration)
+	err = crud.CreateOrUpdateResource(ctx, migration, migration.Namespace, configMap)
+	if err != nil {
+		return err
+	}
+
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	tracing.Inject(ctx, job.Annotations)
+	logger.Info("Creating job", "job", job)
+	return crud.CreateResourceIfNotExists(ctx, migration, migration.Namespace, job)
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -167,5 +493,7 @@ func (r *MigrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&flywayv1alpha1.Migration{}).
 		Owns(&batchv1.Job{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.findMigrationsForSecret), builder.OnlyMetadata).
+		Watches(&flywayv1alpha1.Migration{}, handler.EnqueueRequestsFromMapFunc(r.findDependants)).
 		Complete(r)
 }
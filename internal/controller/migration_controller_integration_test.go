@@ -38,7 +38,7 @@ var _ = Describe("Migration controller", func() {
 					Name:      name,
 				},
 				Spec: flywayv1alpha1.MigrationSpec{
-					Database: flywayv1alpha1.Database{
+					Database: &flywayv1alpha1.Database{
 						Username: "someUser",
 						Credentials: corev1.SecretKeySelector{
 							LocalObjectReference: corev1.LocalObjectReference{
@@ -2,16 +2,19 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
 	"github.com/gophercloud/gophercloud/testhelper"
 	"github.com/redhat-cop/operator-utils/pkg/util"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"testing"
@@ -31,7 +34,7 @@ func TestGithubactionRunnerController(t *testing.T) {
 				BaselineOnMigrate: ptr.To(true),
 				DefaultSchema:     ptr.To("someSchema"),
 			},
-			Database: flywayv1alpha1.Database{
+			Database: &flywayv1alpha1.Database{
 				Username:    "someUser",
 				Credentials: corev1.SecretKeySelector{},
 				JdbcUrl:     "jdbc://db2:somehost:50000/somedb",
@@ -42,29 +45,213 @@ func TestGithubactionRunnerController(t *testing.T) {
 		},
 	}
 
-	objs := []runtime.Object{migration}
 	ctx := context.TODO()
+	r := newTestReconciler(migration)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: namespace,
+			Name:      name,
+		},
+	}
 
+	res, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, res.IsZero())
+}
+
+func newTestReconciler(objs ...client.Object) *MigrationReconciler {
 	s := scheme.Scheme
-	s.AddKnownTypes(flywayv1alpha1.GroupVersion, migration)
+	s.AddKnownTypes(flywayv1alpha1.GroupVersion, &flywayv1alpha1.Migration{}, &flywayv1alpha1.MigrationList{},
+		&flywayv1alpha1.MigrationRun{}, &flywayv1alpha1.MigrationRunList{},
+		&flywayv1alpha1.SchemaRequirement{}, &flywayv1alpha1.SchemaRequirementList{},
+		&flywayv1alpha1.NotificationPolicy{}, &flywayv1alpha1.NotificationPolicyList{},
+		&flywayv1alpha1.ClusterNotificationPolicy{}, &flywayv1alpha1.ClusterNotificationPolicyList{})
 
-	fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(objs...).WithStatusSubresource(migration).Build()
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).
+		WithStatusSubresource(&flywayv1alpha1.Migration{}, &flywayv1alpha1.MigrationRun{}, &flywayv1alpha1.SchemaRequirement{}).Build()
 
-	fakeRecorder := record.NewFakeRecorder(10)
-	r := &MigrationReconciler{
-		ReconcilerBase: util.NewReconcilerBase(fakeClient, s, nil, fakeRecorder, nil),
+	fakeRecorder := events.NewFakeRecorder(100)
+	return &MigrationReconciler{
+		ReconcilerBase: util.NewReconcilerBase(fakeClient, s, nil, NewEventRecorder(fakeRecorder, fakeClient, "Migration"), fakeClient),
 		Client:         fakeClient,
 		Scheme:         s,
+		Recorder:       fakeRecorder,
 	}
+}
 
-	req := reconcile.Request{
-		NamespacedName: types.NamespacedName{
-			Namespace: namespace,
+func TestReconcileMultipleDatabases(t *testing.T) {
+	const namespace = "some-namespace"
+	const name = "some-migration"
+
+	database := func(name string) flywayv1alpha1.DatabaseTarget {
+		return flywayv1alpha1.DatabaseTarget{
+			Name: name,
+			Database: flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  fmt.Sprintf("jdbc:postgresql://somehost/%s", name),
+			},
+		}
+	}
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Databases:      []flywayv1alpha1.DatabaseTarget{database("tenant-a"), database("tenant-b"), database("tenant-c")},
+			MaxConcurrency: 2,
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
 		},
 	}
 
-	res, err := r.Reconcile(ctx, req)
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	jobs := &batchv1.JobList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(namespace)))
+	testhelper.AssertEquals(t, 2, len(jobs.Items))
+	testhelper.AssertEquals(t, "some-migration-tenant-a-b4bb00b6", jobs.Items[0].Name)
+	testhelper.AssertEquals(t, "some-migration-tenant-b-0a1e5323", jobs.Items[1].Name)
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	phases := lo.Map(updated.Status.Targets, func(status flywayv1alpha1.TargetStatus, _ int) flywayv1alpha1.TargetPhase {
+		return status.Phase
+	})
+	testhelper.AssertDeepEquals(t, []flywayv1alpha1.TargetPhase{
+		flywayv1alpha1.TargetRunning, flywayv1alpha1.TargetRunning, flywayv1alpha1.TargetPending,
+	}, phases)
+	testhelper.AssertEquals(t, false, isReady(updated))
+
+	// finish the first job, which frees up capacity for the last database
+	job := &jobs.Items[0]
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(namespace)))
+	testhelper.AssertEquals(t, 3, len(jobs.Items))
+}
+
+func TestCheckClean(t *testing.T) {
+	newMigration := func(allowClean bool, confirmation string) *flywayv1alpha1.Migration {
+		migration := &flywayv1alpha1.Migration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "some-migration",
+				Namespace:  "some-namespace",
+				Generation: 2,
+			},
+			Spec: flywayv1alpha1.MigrationSpec{
+				FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+					Commands:   []string{"clean", "migrate"},
+					AllowClean: allowClean,
+				},
+			},
+		}
+		if confirmation != "" {
+			migration.Annotations = map[string]string{flywayv1alpha1.ConfirmClean: confirmation}
+		}
+		return migration
+	}
+
+	// clean has run for the generation, and its confirmation was removed
+	cleaned := newMigration(true, "")
+	cleaned.Status.Targets = []flywayv1alpha1.TargetStatus{{Name: "default", CleanedGeneration: 2}}
+
+	tests := []struct {
+		name                    string
+		migration               *flywayv1alpha1.Migration
+		cleanDisabledNamespaces []string
+		allowed                 bool
+	}{
+		{
+			name: "no clean",
+			migration: &flywayv1alpha1.Migration{
+				Spec: flywayv1alpha1.MigrationSpec{
+					FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{Commands: []string{"migrate"}},
+				},
+			},
+			allowed: true,
+		},
+		{name: "not allowed", migration: newMigration(false, "2"), allowed: false},
+		{name: "not confirmed", migration: newMigration(true, ""), allowed: false},
+		{name: "confirmed for previous generation", migration: newMigration(true, "1"), allowed: false},
+		{name: "confirmed", migration: newMigration(true, "2"), allowed: true},
+		{name: "disabled in namespace", migration: newMigration(true, "2"), cleanDisabledNamespaces: []string{"some-namespace"}, allowed: false},
+		{name: "disabled in other namespace", migration: newMigration(true, "2"), cleanDisabledNamespaces: []string{"other"}, allowed: true},
+		{name: "disabled in all namespaces", migration: newMigration(true, "2"), cleanDisabledNamespaces: []string{"*"}, allowed: false},
+		{name: "cleaned at generation", migration: cleaned, allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &MigrationReconciler{CleanDisabledNamespaces: tt.cleanDisabledNamespaces}
+			err := r.checkClean(tt.migration)
+			testhelper.AssertEquals(t, tt.allowed, err == nil)
+		})
+	}
+}
+
+func TestReconcileCleanOnce(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "some-migration",
+			Namespace:   "some-namespace",
+			Generation:  2,
+			Annotations: map[string]string{flywayv1alpha1.ConfirmClean: "2"},
+		},
+		Spec: flywayv1alpha1.MigrationSpec{
+			FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+				Commands:   []string{"clean", "migrate"},
+				AllowClean: true,
+			},
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, job))
+	testhelper.AssertEquals(t, true, lo.Contains(job.Spec.Template.Spec.Containers[0].Args, "clean"))
+
+	// the job fails after clean has run, its retry only migrates
+	job.Status.Failed = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, job))
+	testhelper.AssertEquals(t, false, lo.Contains(job.Spec.Template.Spec.Containers[0].Args, "clean"))
+	testhelper.AssertEquals(t, true, lo.Contains(job.Spec.Template.Spec.Containers[0].Args, "migrate"))
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, int64(2), updated.Status.Targets[0].CleanedGeneration)
+	_, confirmed := updated.Annotations[flywayv1alpha1.ConfirmClean]
+	testhelper.AssertEquals(t, false, confirmed)
+
+	// the migration keeps reconciling without the confirmation
+	_, err = r.Reconcile(ctx, req)
 	testhelper.AssertNoErr(t, err)
-	testhelper.AssertEquals(t, true, res.IsZero())
 }
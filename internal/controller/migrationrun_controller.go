@@ -0,0 +1,205 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/redhat-cop/operator-utils/pkg/util"
+	"github.com/redhat-cop/operator-utils/pkg/util/crud"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const actionRun = "run"
+
+// MigrationRunReconciler reconciles a MigrationRun object
+type MigrationRunReconciler struct {
+	util.ReconcilerBase
+	client.Client
+	Scheme *runtime.Scheme
+	// LockNamespace holds the leases locking the databases, the namespace of the migration is used when not set
+	LockNamespace string
+}
+
+//+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=migrationruns,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=migrationruns/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=migrationruns/finalizers,verbs=update
+
+// Reconcile runs the commands of the requested run once against the databases of the referenced migration.
+func (r *MigrationRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	// nolint:staticcheck // SA1029 ignore this!
+	ctx = context.WithValue(ctx, clientContextKey, r.GetClient())
+	logger := log.FromContext(ctx).WithValues("migrationrun", req.NamespacedName)
+
+	run := &flywayv1alpha1.MigrationRun{}
+	if err := r.Get(ctx, req.NamespacedName, run); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if util.IsBeingDeleted(run) || run.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	migration := &flywayv1alpha1.Migration{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: run.Spec.MigrationRef.Name}, migration)
+	if err != nil {
+		return r.ManageError(ctx, run, fmt.Errorf("unable to get migration %s: %w", run.Spec.MigrationRef.Name, err))
+	}
+
+	targets, err := getTargets(ctx, &r.ReconcilerBase, migration)
+	if err != nil {
+		return r.ManageError(ctx, run, err)
+	}
+	if run.Spec.Target != "" {
+		targets = lo.Filter(targets, func(target flywayv1alpha1.DatabaseTarget, _ int) bool { return target.Name == run.Spec.Target })
+	}
+	if len(targets) == 0 {
+		return r.ManageError(ctx, run, fmt.Errorf("migration %s has no database to run against", migration.Name))
+	}
+
+	if run.Status.StartTime == nil {
+		run.Status.StartTime = ptrToNow()
+	}
+	statuses := make([]flywayv1alpha1.TargetStatus, 0, len(targets))
+	locked := false
+	for _, target := range targets {
+		jobName := getRunJobName(run, migration, target)
+		job := &batchv1.Job{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: jobName}, job)
+		switch {
+		case apierrors.IsNotFound(err):
+			// the commands are not run concurrently with the jobs of migrations of the same database
+			holder, err := acquireLock(ctx, r.GetClient(), r.LockNamespace, migration, target, jobName)
+			if err != nil {
+				return r.ManageError(ctx, run, err)
+			}
+			if holder != "" {
+				logger.Info("Database is locked, postponing run", "target", target.Name, "holder", holder)
+				statuses = append(statuses, flywayv1alpha1.TargetStatus{
+					Name: target.Name, JobName: jobName, Generation: migration.Generation, Phase: flywayv1alpha1.TargetPending,
+					Message: fmt.Sprintf("waiting for the lock of the database, held by %s", holder),
+				})
+				locked = true
+				continue
+			}
+			logger.Info("Creating job", "job", jobName)
+			if err := r.submitRunJob(ctx, run, migration, target); err != nil {
+				return r.ManageError(ctx, run, err)
+			}
+			statuses = append(statuses, flywayv1alpha1.TargetStatus{
+				Name: target.Name, JobName: jobName, Generation: migration.Generation, Phase: flywayv1alpha1.TargetRunning,
+			})
+		case err != nil:
+			return r.ManageError(ctx, run, err)
+		default:
+			if isJobFinished(job) {
+				if err := releaseLock(ctx, r.GetClient(), r.LockNamespace, migration, target, jobName); err != nil {
+					return r.ManageError(ctx, run, err)
+				}
+			}
+			statuses = append(statuses, getTargetStatus(target, jobName, job))
+		}
+	}
+
+	run.Status.Targets = statuses
+	setRunPhase(run)
+
+	if locked {
+		return r.ManageSuccessWithRequeue(ctx, run, lockRetryInterval)
+	}
+	return r.ManageSuccess(ctx, run)
+}
+
+// getRunJobName returns the name of the job running the commands against the target, named like the jobs of other
+// actions of the migration, so it does not collide with the jobs of the migration.
+func getRunJobName(run *flywayv1alpha1.MigrationRun, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) string {
+	return getName(getJobNameParts(migration, target, actionRun, run.Name)...)
+}
+
+// createRunJobSpec creates the job running the commands of the run, with the settings of the migration.
+func createRunJobSpec(run *flywayv1alpha1.MigrationRun, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) *batchv1.Job {
+	commands := lo.Map(run.Spec.Commands, func(command flywayv1alpha1.RunCommand, _ int) string { return string(command) })
+	job := createCommandJobSpec(migration, target, actionRun, commands...)
+	job.Name = getRunJobName(run, migration, target)
+
+	return job
+}
+
+// submitRunJob creates the job of the run, the flyway configuration is owned by the migration and shared with its jobs.
+func (r *MigrationRunReconciler) submitRunJob(ctx context.Context, run *flywayv1alpha1.MigrationRun, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) error {
+	configMap, err := createConfigMapSpec(migration, target)
+	if err != nil {
+		return err
+	}
+	if err := crud.CreateOrUpdateResource(ctx, migration, migration.Namespace, configMap); err != nil {
+		return err
+	}
+
+	return crud.CreateResourceIfNotExists(ctx, run, run.Namespace, createRunJobSpec(run, migration, target))
+}
+
+// setRunPhase aggregates the state of all targets into the phase of the run.
+func setRunPhase(run *flywayv1alpha1.MigrationRun) {
+	count := func(phase flywayv1alpha1.TargetPhase) int {
+		return lo.CountBy(run.Status.Targets, func(status flywayv1alpha1.TargetStatus) bool { return status.Phase == phase })
+	}
+	succeeded, failed := count(flywayv1alpha1.TargetSucceeded), count(flywayv1alpha1.TargetFailed)
+
+	condition := metav1.Condition{
+		Type:    flywayv1alpha1.ConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  "Running",
+		Message: fmt.Sprintf("%d of %d databases done", succeeded+failed, len(run.Status.Targets)),
+	}
+	run.Status.Phase = flywayv1alpha1.TargetRunning
+	switch {
+	case succeeded == len(run.Status.Targets):
+		run.Status.Phase = flywayv1alpha1.TargetSucceeded
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Succeeded"
+	case succeeded+failed == len(run.Status.Targets):
+		run.Status.Phase = flywayv1alpha1.TargetFailed
+		condition.Reason = "Failed"
+		condition.Message = fmt.Sprintf("%d of %d databases failed", failed, len(run.Status.Targets))
+	}
+	if run.IsFinished() {
+		run.Status.CompletionTime = ptrToNow()
+	}
+	meta.SetStatusCondition(&run.Status.Conditions, condition)
+}
+
+func ptrToNow() *metav1.Time {
+	now := metav1.Now()
+	return &now
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MigrationRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&flywayv1alpha1.MigrationRun{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
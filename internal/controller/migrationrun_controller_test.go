@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileMigrationRun(t *testing.T) {
+	const namespace = "some-namespace"
+
+	database := func(name string) flywayv1alpha1.DatabaseTarget {
+		return flywayv1alpha1.DatabaseTarget{
+			Name: name,
+			Database: flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  fmt.Sprintf("jdbc:postgresql://somehost/%s", name),
+			},
+		}
+	}
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: namespace},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Databases: []flywayv1alpha1.DatabaseTarget{database("tenant-a"), database("tenant-b")},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+	run := &flywayv1alpha1.MigrationRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-run", Namespace: namespace},
+		Spec: flywayv1alpha1.MigrationRunSpec{
+			MigrationRef: corev1.LocalObjectReference{Name: migration.Name},
+			Commands:     []flywayv1alpha1.RunCommand{"validate", "info"},
+			Target:       "tenant-b",
+		},
+	}
+
+	ctx := context.TODO()
+	base := newTestReconciler(migration, run)
+	r := &MigrationRunReconciler{ReconcilerBase: base.ReconcilerBase, Client: base.Client, Scheme: base.Scheme}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: run.Name}}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	// the commands run against the requested database only, with the flyway configuration of the migration
+	jobs := &batchv1.JobList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(namespace)))
+	testhelper.AssertEquals(t, 1, len(jobs.Items))
+	job := &jobs.Items[0]
+	testhelper.AssertEquals(t, "some-migration-tenant-b-run-some-run-bb3390c4", job.Name)
+	testhelper.AssertDeepEquals(t, []string{"validate", "info", "-outputType=json", "-configFiles=/flyway/operator/flyway.toml"},
+		job.Spec.Template.Spec.Containers[0].Args)
+	testhelper.AssertEquals(t, "some-run", job.OwnerReferences[0].Name)
+	configMap := &corev1.ConfigMap{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKey{Namespace: namespace, Name: "some-migration-tenant-b-0a1e5323"}, configMap))
+
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	updated := &flywayv1alpha1.MigrationRun{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, flywayv1alpha1.TargetSucceeded, updated.Status.Phase)
+	testhelper.AssertEquals(t, true, updated.Status.StartTime != nil && updated.Status.CompletionTime != nil)
+}
+
+func TestReconcileMigrationRunWaitingForLock(t *testing.T) {
+	const namespace = "some-namespace"
+
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: namespace},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+	run := &flywayv1alpha1.MigrationRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-run", Namespace: namespace},
+		Spec: flywayv1alpha1.MigrationRunSpec{
+			MigrationRef: corev1.LocalObjectReference{Name: migration.Name},
+			Commands:     []flywayv1alpha1.RunCommand{"repair"},
+		},
+	}
+
+	ctx := context.TODO()
+	base := newTestReconciler(migration, run)
+	r := &MigrationRunReconciler{ReconcilerBase: base.ReconcilerBase, Client: base.Client, Scheme: base.Scheme}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: run.Name}}
+
+	// the migration job holds the lock of the database
+	_, err := base.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)})
+	testhelper.AssertNoErr(t, err)
+	migrationJob := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), migrationJob))
+
+	result, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, lockRetryInterval, result.RequeueAfter)
+	updated := &flywayv1alpha1.MigrationRun{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, flywayv1alpha1.TargetPending, updated.Status.Targets[0].Phase)
+	testhelper.AssertEquals(t, "waiting for the lock of the database, held by some-namespace/some-migration", updated.Status.Targets[0].Message)
+
+	migrationJob.Status.Succeeded = 1
+	migrationJob.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, migrationJob))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	// the job of the run does not take the name of the job of the migration
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, types.NamespacedName{Namespace: namespace, Name: "some-migration-run-some-run-661d7b17"}, &batchv1.Job{}))
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/davidkarlsen/flyway-operator/internal/notification"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// notificationTimeout bounds how long a receiver may take, as notifying holds up the reconcile
+	notificationTimeout = 10 * time.Second
+	// notificationRetryInterval is how often undelivered notifications are sent again
+	notificationRetryInterval = time.Minute
+	// maxNotificationAttempts is how often sending a notification fails before it is given up on
+	maxNotificationAttempts = 5
+	// maxUndeliveredNotifications bounds the undelivered notifications kept in the status, the oldest are given up on
+	maxUndeliveredNotifications = 20
+)
+
+//+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=notificationpolicies;clusternotificationpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get
+
+// notificationPolicy is a namespaced or cluster-scoped policy, along with the namespace of the secrets of its receivers
+type notificationPolicy struct {
+	flywayv1alpha1.NotificationPolicySpec
+	// name is namespace/name for namespaced policies
+	name            string
+	secretNamespace string
+}
+
+// getNotifications returns the transitions of the migration made by the reconcile, which recorded the given runs:
+// a job of the migration, or rollback, failed, or the migration, or rollback, has been applied to all databases.
+func getNotifications(migration *flywayv1alpha1.Migration, action string, wasReady bool, recorded []flywayv1alpha1.HistoryEntry) []*notification.Notification {
+	create := func(event flywayv1alpha1.NotificationEvent, entryAction string) *notification.Notification {
+		return &notification.Notification{
+			Event:            event,
+			Namespace:        migration.Namespace,
+			Migration:        migration.Name,
+			Generation:       migration.Generation,
+			Action:           entryAction,
+			RequestedVersion: migration.Status.RequestedVersion,
+			CurrentVersion:   migration.Status.CurrentVersion,
+			Targets: lo.Map(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus, _ int) notification.TargetVersion {
+				return notification.TargetVersion{Name: status.Name, CurrentVersion: status.CurrentVersion}
+			}),
+			Time: time.Now(),
+		}
+	}
+
+	var notifications []*notification.Notification
+	for _, entry := range recorded {
+		if entry.Result != flywayv1alpha1.TargetFailed || (entry.Action != actionMigrate && entry.Action != actionRollback) {
+			continue
+		}
+		failed := create(flywayv1alpha1.NotificationFailed, entry.Action)
+		failed.Target = entry.Target
+		failed.Message = entry.Message
+		if entry.CompletionTime != nil {
+			failed.Time = entry.CompletionTime.Time
+		}
+		notifications = append(notifications, failed)
+	}
+	if isApplied(migration, action, wasReady) {
+		notifications = append(notifications, create(flywayv1alpha1.NotificationSucceeded, action))
+	}
+
+	return notifications
+}
+
+// notify sends the notifications, along with those undelivered before, to the receivers of the policies selecting the
+// migration. Failed deliveries are kept in the status and sent again by later reconciles, rather than failing the
+// reconcile, which would not notify again. Deliveries to policies and receivers which are gone are dropped.
+// It returns when to reconcile to send the undelivered notifications again.
+func (r *MigrationReconciler) notify(ctx context.Context, migration *flywayv1alpha1.Migration, notifications []*notification.Notification) (time.Duration, error) {
+	previous := migration.Status.UndeliveredNotifications
+	deliveries := append(slices.Clone(previous), lo.Map(notifications, func(n *notification.Notification, _ int) flywayv1alpha1.UndeliveredNotification {
+		return toUndeliveredNotification(n)
+	})...)
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+
+	var undelivered []flywayv1alpha1.UndeliveredNotification
+	fail := func(delivery flywayv1alpha1.UndeliveredNotification, err error) {
+		receiver := lo.CoalesceOrEmpty(delivery.Receiver, "the receivers")
+		log.FromContext(ctx).Error(err, "unable to notify", "receiver", receiver, "event", delivery.Event)
+		delivery.Attempts++
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= maxNotificationAttempts {
+			r.GetRecorder().Event(migration, corev1.EventTypeWarning, "NotificationFailed",
+				fmt.Sprintf("Notifying %s of %s failed %d times, giving up: %s", receiver, delivery.Event, delivery.Attempts, err))
+			return
+		}
+		r.GetRecorder().Event(migration, corev1.EventTypeWarning, "NotificationFailed",
+			fmt.Sprintf("Notifying %s of %s failed, retrying: %s", receiver, delivery.Event, err))
+		undelivered = append(undelivered, delivery)
+	}
+
+	policies, err := r.getNotificationPolicies(ctx, migration)
+	if err != nil {
+		for _, delivery := range deliveries {
+			fail(delivery, fmt.Errorf("getting notification policies failed: %w", err))
+		}
+	}
+
+	notifier := r.Notifier
+	if notifier == nil {
+		notifier = notification.NewHTTPNotifier(notificationTimeout, r.AllowPrivateReceivers)
+	}
+	for _, delivery := range deliveries {
+		n := toNotification(migration, delivery)
+		for _, policy := range policies {
+			if !policy.IsNotified(delivery.Event) || (delivery.Policy != "" && delivery.Policy != policy.name) {
+				continue
+			}
+			for _, receiver := range policy.Receivers {
+				if delivery.Receiver != "" && delivery.Receiver != receiver.Name {
+					continue
+				}
+				if err := r.notifyReceiver(ctx, notifier, policy.secretNamespace, receiver, n); err != nil {
+					retry := delivery
+					retry.Policy, retry.Receiver = policy.name, receiver.Name
+					fail(retry, err)
+				}
+			}
+		}
+	}
+	undelivered = undelivered[max(0, len(undelivered)-maxUndeliveredNotifications):]
+
+	if !equality.Semantic.DeepEqual(previous, undelivered) {
+		migration.Status.UndeliveredNotifications = undelivered
+		if err := r.GetClient().Status().Update(ctx, migration); err != nil {
+			return 0, err
+		}
+	}
+
+	return lo.Ternary(len(undelivered) > 0, notificationRetryInterval, 0), nil
+}
+
+// toUndeliveredNotification returns the notification as it is kept in the status until it is delivered.
+func toUndeliveredNotification(n *notification.Notification) flywayv1alpha1.UndeliveredNotification {
+	return flywayv1alpha1.UndeliveredNotification{
+		Event:            n.Event,
+		Action:           n.Action,
+		Generation:       n.Generation,
+		Target:           n.Target,
+		Message:          n.Message,
+		RequestedVersion: n.RequestedVersion,
+		CurrentVersion:   n.CurrentVersion,
+		Time:             metav1.NewTime(n.Time),
+	}
+}
+
+// toNotification returns the notification to deliver, along with the versions the databases are at now.
+func toNotification(migration *flywayv1alpha1.Migration, delivery flywayv1alpha1.UndeliveredNotification) *notification.Notification {
+	return &notification.Notification{
+		Event:            delivery.Event,
+		Namespace:        migration.Namespace,
+		Migration:        migration.Name,
+		Generation:       delivery.Generation,
+		Action:           delivery.Action,
+		RequestedVersion: delivery.RequestedVersion,
+		CurrentVersion:   delivery.CurrentVersion,
+		Target:           delivery.Target,
+		Message:          delivery.Message,
+		Targets: lo.Map(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus, _ int) notification.TargetVersion {
+			return notification.TargetVersion{Name: status.Name, CurrentVersion: status.CurrentVersion}
+		}),
+		Time: delivery.Time.Time,
+	}
+}
+
+func (r *MigrationReconciler) notifyReceiver(ctx context.Context, notifier notification.Notifier, namespace string, receiver flywayv1alpha1.Receiver,
+	n *notification.Notification) error {
+	// secrets are read directly, so that the operator does not have to cache all secrets in the cluster
+	secret := &corev1.Secret{}
+	if err := r.GetAPIReader().Get(ctx, client.ObjectKey{Namespace: namespace, Name: receiver.URLSecretRef.Name}, secret); err != nil {
+		return err
+	}
+	url, found := secret.Data[receiver.URLSecretRef.Key]
+	if !found {
+		return fmt.Errorf("secret %s lacks the key %s", receiver.URLSecretRef.Name, receiver.URLSecretRef.Key)
+	}
+
+	return notifier.Notify(ctx, receiver.Type, string(url), n)
+}
+
+// getNotificationPolicies returns the namespaced and cluster-scoped policies selecting the migration.
+func (r *MigrationReconciler) getNotificationPolicies(ctx context.Context, migration *flywayv1alpha1.Migration) ([]notificationPolicy, error) {
+	var policies []notificationPolicy
+
+	namespaced := &flywayv1alpha1.NotificationPolicyList{}
+	if err := r.GetClient().List(ctx, namespaced, client.InNamespace(migration.Namespace)); err != nil {
+		return nil, err
+	}
+	for _, policy := range namespaced.Items {
+		selected, err := isSelected(policy.Spec.Selector, migration.Labels)
+		if err != nil {
+			return nil, err
+		}
+		if selected {
+			policies = append(policies, notificationPolicy{NotificationPolicySpec: policy.Spec,
+				name: policy.Namespace + "/" + policy.Name, secretNamespace: policy.Namespace})
+		}
+	}
+
+	clustered := &flywayv1alpha1.ClusterNotificationPolicyList{}
+	if err := r.GetClient().List(ctx, clustered); err != nil {
+		return nil, err
+	}
+	var namespace *corev1.Namespace
+	for _, policy := range clustered.Items {
+		selected, err := isSelected(policy.Spec.Selector, migration.Labels)
+		if err != nil {
+			return nil, err
+		}
+		if selected && policy.Spec.NamespaceSelector != nil {
+			if namespace == nil {
+				namespace = &corev1.Namespace{}
+				if err := r.GetAPIReader().Get(ctx, client.ObjectKey{Name: migration.Namespace}, namespace); err != nil {
+					return nil, err
+				}
+			}
+			if selected, err = isSelected(policy.Spec.NamespaceSelector, namespace.Labels); err != nil {
+				return nil, err
+			}
+		}
+		if selected {
+			policies = append(policies, notificationPolicy{NotificationPolicySpec: policy.Spec.NotificationPolicySpec,
+				name: policy.Name, secretNamespace: r.OperatorNamespace})
+		}
+	}
+
+	return policies, nil
+}
+
+// isSelected returns true if the labels match the selector, a selector which is not set matches all labels.
+func isSelected(selector *metav1.LabelSelector, objectLabels map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+
+	return labelSelector.Matches(labels.Set(objectLabels)), nil
+}
@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/davidkarlsen/flyway-operator/internal/notification"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeNotifier records the notifications instead of sending them, failing them with err when it is set
+type fakeNotifier struct {
+	notified []string
+	err      error
+}
+
+func (f *fakeNotifier) Notify(_ context.Context, receiverType flywayv1alpha1.ReceiverType, url string, n *notification.Notification) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.notified = append(f.notified, fmt.Sprintf("%s %s %s %s", receiverType, url, n.Event, n.Target))
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	const namespace = "some-namespace"
+
+	receiver := func(receiverType flywayv1alpha1.ReceiverType) []flywayv1alpha1.Receiver {
+		return []flywayv1alpha1.Receiver{{
+			Name:         "some-receiver",
+			Type:         receiverType,
+			URLSecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"}, Key: "url"},
+		}}
+	}
+	objects := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{"environment": "production"}}},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: namespace},
+			Data:       map[string][]byte{"url": []byte("https://hooks.slack.com/some")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "flyway-system"},
+			Data:       map[string][]byte{"url": []byte("https://teams.example.com/some")},
+		},
+		&flywayv1alpha1.NotificationPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "some-policy", Namespace: namespace},
+			Spec: flywayv1alpha1.NotificationPolicySpec{
+				Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"app": "some-app"}},
+				Receivers: receiver(flywayv1alpha1.ReceiverSlack),
+			},
+		},
+		&flywayv1alpha1.ClusterNotificationPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "production"},
+			Spec: flywayv1alpha1.ClusterNotificationPolicySpec{
+				NotificationPolicySpec: flywayv1alpha1.NotificationPolicySpec{
+					Events:    []flywayv1alpha1.NotificationEvent{flywayv1alpha1.NotificationFailed},
+					Receivers: receiver(flywayv1alpha1.ReceiverTeams),
+				},
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"environment": "production"}},
+			},
+		},
+		&flywayv1alpha1.ClusterNotificationPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: flywayv1alpha1.ClusterNotificationPolicySpec{
+				NotificationPolicySpec: flywayv1alpha1.NotificationPolicySpec{Receivers: receiver(flywayv1alpha1.ReceiverWebhook)},
+				NamespaceSelector:      &metav1.LabelSelector{MatchLabels: map[string]string{"environment": "test"}},
+			},
+		},
+	}
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: namespace, Labels: map[string]string{"app": "some-app"}},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(append(objects, migration)...)
+	r.LogReader = fakeLogReader(compositeOutput)
+	r.OperatorNamespace = "flyway-system"
+	notifier := &fakeNotifier{}
+	r.Notifier = notifier
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, 0, len(notifier.notified))
+
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+	job.Status.Failed = 3
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertDeepEquals(t, []string{
+		"Slack https://hooks.slack.com/some Failed default",
+		"Teams https://teams.example.com/some Failed default",
+	}, notifier.notified)
+
+	// the job is retried and succeeds, which only the namespaced policy is notified of
+	notifier.notified = nil
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	for range 2 {
+		_, err = r.Reconcile(ctx, req)
+		testhelper.AssertNoErr(t, err)
+	}
+	testhelper.AssertDeepEquals(t, []string{"Slack https://hooks.slack.com/some Succeeded "}, notifier.notified)
+}
+
+func TestNotifyUndelivered(t *testing.T) {
+	const namespace = "some-namespace"
+
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: namespace},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: namespace},
+		Data:       map[string][]byte{"url": []byte("https://hooks.slack.com/some")},
+	}
+	policy := &flywayv1alpha1.NotificationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-policy", Namespace: namespace},
+		Spec: flywayv1alpha1.NotificationPolicySpec{
+			Receivers: []flywayv1alpha1.Receiver{{
+				Name:         "some-receiver",
+				Type:         flywayv1alpha1.ReceiverSlack,
+				URLSecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"}, Key: "url"},
+			}},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration, secret, policy)
+	r.LogReader = fakeLogReader(compositeOutput)
+	notifier := &fakeNotifier{err: errors.New("503 Service Unavailable")}
+	r.Notifier = notifier
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+	job.Status.Failed = 3
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	// the failed delivery is kept, and sent again later
+	result, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, result.RequeueAfter > 0 && result.RequeueAfter <= notificationRetryInterval)
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, 1, len(updated.Status.UndeliveredNotifications))
+	undelivered := updated.Status.UndeliveredNotifications[0]
+	testhelper.AssertEquals(t, "some-namespace/some-policy", undelivered.Policy)
+	testhelper.AssertEquals(t, "some-receiver", undelivered.Receiver)
+	testhelper.AssertEquals(t, flywayv1alpha1.NotificationFailed, undelivered.Event)
+	testhelper.AssertEquals(t, int32(1), undelivered.Attempts)
+	testhelper.AssertEquals(t, "503 Service Unavailable", undelivered.LastError)
+
+	notifier.err = nil
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertDeepEquals(t, []string{"Slack https://hooks.slack.com/some Failed default"}, notifier.notified)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, 0, len(updated.Status.UndeliveredNotifications))
+
+	// a delivery failing too often is given up on
+	notifier.err = errors.New("503 Service Unavailable")
+	updated.Status.UndeliveredNotifications = []flywayv1alpha1.UndeliveredNotification{{
+		Policy: "some-namespace/some-policy", Receiver: "some-receiver", Event: flywayv1alpha1.NotificationFailed,
+		Action: actionMigrate, Attempts: maxNotificationAttempts - 1,
+	}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, updated))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, 0, len(updated.Status.UndeliveredNotifications))
+}
+
+func TestFailuresReportedOnceBeyondHistory(t *testing.T) {
+	const namespace = "some-namespace"
+
+	migration := newRollbackMigration(flywayv1alpha1.RollbackUndo)
+	migration.Spec.Database = nil
+	for i := range maxHistory + 2 {
+		name := fmt.Sprintf("tenant-%d", i)
+		migration.Spec.Databases = append(migration.Spec.Databases, flywayv1alpha1.DatabaseTarget{
+			Name:     name,
+			Database: flywayv1alpha1.Database{Username: "someUser", JdbcUrl: "jdbc:postgresql://somehost/" + name},
+		})
+	}
+	migration.Spec.MaxConcurrency = int32(len(migration.Spec.Databases))
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: namespace},
+		Data:       map[string][]byte{"url": []byte("https://hooks.slack.com/some")},
+	}
+	policy := &flywayv1alpha1.NotificationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-policy", Namespace: namespace},
+		Spec: flywayv1alpha1.NotificationPolicySpec{
+			Events: []flywayv1alpha1.NotificationEvent{flywayv1alpha1.NotificationFailed},
+			Receivers: []flywayv1alpha1.Receiver{{
+				Name:         "some-receiver",
+				Type:         flywayv1alpha1.ReceiverWebhook,
+				URLSecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"}, Key: "url"},
+			}},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration, secret, policy)
+	notifier := &fakeNotifier{}
+	r.Notifier = notifier
+	recorder := r.Recorder.(*events.FakeRecorder)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	jobs := &batchv1.JobList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(namespace)))
+	testhelper.AssertEquals(t, len(migration.Spec.Databases), len(jobs.Items))
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		// the fake client does not assign UIDs, which tell the jobs apart
+		job.UID = types.UID(job.Name)
+		testhelper.AssertNoErr(t, r.GetClient().Update(ctx, job))
+		job.Status.Failed = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+		testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	}
+	drainEvents(recorder)
+
+	// the failed rollbacks are not retried, and their failures are reported once
+	failed := 0
+	for range 3 {
+		_, err = r.Reconcile(ctx, req)
+		testhelper.AssertNoErr(t, err)
+		failed += len(lo.Filter(drainEvents(recorder), func(event string, _ int) bool { return strings.Contains(event, reasonJobFailed) }))
+	}
+	testhelper.AssertEquals(t, len(migration.Spec.Databases), failed)
+	testhelper.AssertEquals(t, len(migration.Spec.Databases), len(notifier.notified))
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+)
+
+// flywayOutput is the output of flyway with -outputType=json, running several commands yields a composite result.
+type flywayOutput struct {
+	flywayResult
+	IndividualResults []flywayResult `json:"individualResults"`
+}
+
+// flywayResult is the result of a single flyway command, holding the fields of the commands the operator looks at.
+type flywayResult struct {
+	Operation string `json:"operation"`
+	// info
+	SchemaVersion string                `json:"schemaVersion"`
+	Migrations    []flywayMigrationInfo `json:"migrations"`
+	// migrate
+	InitialSchemaVersion string `json:"initialSchemaVersion"`
+	TargetSchemaVersion  string `json:"targetSchemaVersion"`
+	// validate
+	ValidationSuccessful *bool                    `json:"validationSuccessful"`
+	InvalidMigrations    []flywayInvalidMigration `json:"invalidMigrations"`
+
+	Error *flywayError `json:"error"`
+}
+
+type flywayInvalidMigration struct {
+	Version      string `json:"version"`
+	Description  string `json:"description"`
+	ErrorDetails struct {
+		ErrorMessage string `json:"errorMessage"`
+	} `json:"errorDetails"`
+}
+
+type flywayError struct {
+	Message string `json:"message"`
+}
+
+type flywayMigrationInfo struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	FilePath    string `json:"filepath"`
+}
+
+// getName returns the name of the script of the migration, or its version and description when not known.
+func (m flywayMigrationInfo) getName() string {
+	if m.FilePath != "" {
+		return path.Base(m.FilePath)
+	}
+	version, _ := lo.Coalesce(m.Version, "R")
+
+	return fmt.Sprintf("%s %s", version, m.Description)
+}
+
+// parseFlywayOutput reads the results of the commands from the log of a flyway container.
+// Any lines logged before the json output are skipped.
+func parseFlywayOutput(log string) ([]flywayResult, error) {
+	start := strings.Index(log, "\n{")
+	if strings.HasPrefix(log, "{") {
+		start = 0
+	}
+	if start < 0 {
+		return nil, errors.New("no json output found")
+	}
+
+	output := flywayOutput{}
+	if err := json.NewDecoder(strings.NewReader(log[start:])).Decode(&output); err != nil {
+		return nil, err
+	}
+	if len(output.IndividualResults) > 0 {
+		return output.IndividualResults, nil
+	}
+
+	return []flywayResult{output.flywayResult}, nil
+}
+
+// getSchemaVersion returns the schema version of the database after the commands ran.
+func getSchemaVersion(results []flywayResult) string {
+	version := ""
+	for _, result := range results {
+		switch {
+		case result.SchemaVersion != "": // info
+			version = result.SchemaVersion
+		case result.TargetSchemaVersion != "": // migrate, which applied migrations
+			version = result.TargetSchemaVersion
+		case result.InitialSchemaVersion != "": // migrate, without pending migrations
+			version = result.InitialSchemaVersion
+		}
+	}
+
+	return version
+}
+
+// getLastInfo returns the result of the last info, and whether info was run at all.
+func getLastInfo(results []flywayResult) (flywayResult, bool) {
+	return lo.Find(lo.Reverse(slices.Clone(results)), func(result flywayResult) bool {
+		return result.Operation == "info"
+	})
+}
+
+// getPendingMigrations returns the names of the migrations the last info reported as pending,
+// and whether info was run at all.
+func getPendingMigrations(results []flywayResult) ([]string, bool) {
+	info, found := getLastInfo(results)
+	if !found {
+		return nil, false
+	}
+
+	return lo.FilterMap(info.Migrations, func(migration flywayMigrationInfo, _ int) (string, bool) {
+		return migration.getName(), migration.State == "Pending"
+	}), true
+}
+
+// appliedStates are the states info reports for migrations which have been applied to the database
+var appliedStates = []string{"Success", "Out of Order", "Future"}
+
+// getVersionsToUndo returns the versions above the target version the last info reported as applied, newest first.
+func getVersionsToUndo(results []flywayResult, targetVersion string) []string {
+	info, _ := getLastInfo(results)
+	versions := lo.Uniq(lo.FilterMap(info.Migrations, func(migration flywayMigrationInfo, _ int) (string, bool) {
+		return migration.Version, migration.Version != "" && lo.Contains(appliedStates, migration.State) &&
+			flywayv1alpha1.CompareVersions(migration.Version, targetVersion) > 0
+	}))
+	slices.SortFunc(versions, func(a, b string) int { return flywayv1alpha1.CompareVersions(b, a) })
+
+	return versions
+}
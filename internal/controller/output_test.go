@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeLogReader returns the same log for all jobs
+type fakeLogReader string
+
+func (r fakeLogReader) ReadLog(context.Context, *batchv1.Job) (string, error) {
+	return string(r), nil
+}
+
+const compositeOutput = `WARNING: some warning
+{
+  "individualResults": [
+    {"operation": "info", "schemaVersion": "1.1", "migrations": []},
+    {"operation": "migrate", "initialSchemaVersion": "1.1", "targetSchemaVersion": "1.3", "migrationsExecuted": 2},
+    {"operation": "info", "schemaVersion": "1.3", "migrations": []}
+  ]
+}`
+
+func TestParseFlywayOutput(t *testing.T) {
+	results, err := parseFlywayOutput(compositeOutput)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, 3, len(results))
+	testhelper.AssertEquals(t, "1.3", getSchemaVersion(results))
+
+	// nothing to migrate
+	results, err = parseFlywayOutput(`{"operation": "migrate", "initialSchemaVersion": "2", "targetSchemaVersion": null}`)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, 1, len(results))
+	testhelper.AssertEquals(t, "2", getSchemaVersion(results))
+
+	_, err = parseFlywayOutput("ERROR: unable to connect")
+	testhelper.AssertErr(t, err)
+}
+
+func TestGetVersionsToUndo(t *testing.T) {
+	results, err := parseFlywayOutput(`{"operation": "info", "schemaVersion": "1.10", "migrations": [
+  {"version": "1.1", "description": "init", "state": "Success"},
+  {"version": "1.10", "description": "out of order", "state": "Out of Order"},
+  {"version": "1.3", "description": "failed", "state": "Failed"},
+  {"version": "1.9", "description": "alter", "state": "Success"},
+  {"version": "", "description": "repeatable", "state": "Success"},
+  {"version": "1.11", "description": "next", "state": "Pending"}
+]}`)
+	testhelper.AssertNoErr(t, err)
+	// applied versions above the target, newest first
+	testhelper.AssertDeepEquals(t, []string{"1.10", "1.9"}, getVersionsToUndo(results, "1.2"))
+	testhelper.AssertEquals(t, 0, len(getVersionsToUndo(results, "1.10")))
+	testhelper.AssertEquals(t, 0, len(getVersionsToUndo(nil, "1.2")))
+}
+
+func TestReconcileVersions(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+				Target: ptr.To("1.3"),
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(compositeOutput)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	// the version is kept once the output has been read
+	for range 2 {
+		_, err = r.Reconcile(ctx, req)
+		testhelper.AssertNoErr(t, err)
+	}
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, "1.3", updated.Status.RequestedVersion)
+	testhelper.AssertEquals(t, "1.3", updated.Status.CurrentVersion)
+	testhelper.AssertEquals(t, "1.3", updated.Status.Targets[0].CurrentVersion)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// actionCompleted flags the jobs of a one-shot action which has been completed,
+// so that a later request of the same action runs new jobs.
+const actionCompleted = flywayv1alpha1.Prefix + "/" + "action-completed"
+
+// reconcileRepair runs flyway repair against all targets when requested by the action annotation.
+// Once all repairs have finished, their outcome is recorded and the annotation is removed.
+// It returns whether a repair is in progress, in which case the regular migration waits.
+func (r *MigrationReconciler) reconcileRepair(ctx context.Context, migration *flywayv1alpha1.Migration) (bool, error) {
+	if migration.Annotations[flywayv1alpha1.Action] != actionRepair {
+		return false, nil
+	}
+	logger := log.FromContext(ctx)
+
+	targets, err := getTargets(ctx, &r.ReconcilerBase, migration)
+	if err != nil {
+		return false, err
+	}
+
+	var finished []*batchv1.Job
+	inProgress := false
+	for _, target := range targets {
+		job, err := r.getExistingJob(ctx, migration, getActionJobName(migration, target, actionRepair))
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case job == nil || job.Annotations[actionCompleted] == "true": // a new request
+			logger.Info("Repair requested", "target", target.Name)
+			holder, err := acquireLock(ctx, r.GetClient(), r.LockNamespace, migration, target, getActionJobName(migration, target, actionRepair))
+			if err != nil {
+				return false, err
+			}
+			if holder != "" {
+				logger.Info("Database is locked, postponing repair", "target", target.Name, "holder", holder)
+				inProgress = true
+				continue
+			}
+			if err := r.submitMigrationJob(ctx, migration, target, createActionJobSpec(migration, target, actionRepair)); err != nil {
+				return false, err
+			}
+			inProgress = true
+		case !isJobFinished(job):
+			inProgress = true
+		default:
+			if recordHistory(migration, getTargetStatusRef(migration, target), job) {
+				if err := releaseLock(ctx, r.GetClient(), r.LockNamespace, migration, target, job.Name); err != nil {
+					return false, err
+				}
+				r.recordRepairEvent(migration, target, job)
+				r.traceJob(ctx, migration, target, job)
+			}
+			finished = append(finished, job)
+		}
+	}
+	if inProgress {
+		return true, nil
+	}
+
+	for _, job := range finished {
+		patch := client.MergeFrom(job.DeepCopy())
+		job.Annotations[actionCompleted] = "true"
+		if err := r.GetClient().Patch(ctx, job, patch); err != nil {
+			return false, err
+		}
+	}
+
+	return false, r.clearAction(ctx, migration)
+}
+
+func (r *MigrationReconciler) recordRepairEvent(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, job *batchv1.Job) {
+	if hasFailed(job) {
+		r.GetRecorder().Event(migration, corev1.EventTypeWarning, "RepairFailed",
+			fmt.Sprintf("Repair of database %s failed: %s", target.Name, getJobFailure(job)))
+		return
+	}
+	r.GetRecorder().Event(migration, corev1.EventTypeNormal, "Repaired", fmt.Sprintf("Repaired database %s", target.Name))
+}
+
+// clearAction removes the action annotation once the action has been completed.
+// A copy is patched, so that the changes to the status of the migration are kept.
+func (r *MigrationReconciler) clearAction(ctx context.Context, migration *flywayv1alpha1.Migration) error {
+	cleared := migration.DeepCopy()
+	delete(cleared.Annotations, flywayv1alpha1.Action)
+	if err := r.GetClient().Patch(ctx, cleared, client.MergeFrom(migration)); err != nil {
+		return err
+	}
+	migration.Annotations = cleared.Annotations
+	migration.ResourceVersion = cleared.ResourceVersion
+
+	return nil
+}
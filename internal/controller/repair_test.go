@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileRepair(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "some-migration",
+			Namespace:   "some-namespace",
+			Annotations: map[string]string{flywayv1alpha1.Action: "repair"},
+		},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+				Commands: []string{"migrate"},
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	// only the repair runs, with the connection of the migration
+	jobs := &batchv1.JobList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(migration.Namespace)))
+	testhelper.AssertEquals(t, 1, len(jobs.Items))
+	job := &jobs.Items[0]
+	testhelper.AssertEquals(t, "some-migration-repair-bfc8377a", job.Name)
+	testhelper.AssertEquals(t, "repair", job.Spec.Template.Spec.Containers[0].Args[0])
+
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	_, requested := updated.Annotations[flywayv1alpha1.Action]
+	testhelper.AssertEquals(t, false, requested)
+	testhelper.AssertEquals(t, 1, len(updated.Status.History))
+	testhelper.AssertEquals(t, actionRepair, updated.Status.History[0].Action)
+	testhelper.AssertEquals(t, flywayv1alpha1.TargetSucceeded, updated.Status.History[0].Result)
+
+	// the regular migration resumes, and the repair is not repeated
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(job), job))
+	testhelper.AssertEquals(t, "true", job.Annotations[actionCompleted])
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(migration.Namespace)))
+	testhelper.AssertEquals(t, 2, len(jobs.Items))
+	testhelper.AssertEquals(t, "some-migration", jobs.Items[0].Name)
+	testhelper.AssertDeepEquals(t, []string{"migrate"}, updated.Spec.FlywayConfiguration.Commands)
+}
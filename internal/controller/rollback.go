@@ -0,0 +1,120 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	undoScriptsDir       = "/tmp/undo"
+	rollbackTargetEnvVar = "ROLLBACK_TARGET_VERSION"
+	// defaultUndoSqlMigrationPrefix is the file name prefix of undo-scripts, unless configured otherwise
+	defaultUndoSqlMigrationPrefix = "U"
+)
+
+// undoScriptsRollback runs the undo-scripts of the versions to undo, newest first, and removes the undone versions from
+// the schema history table. The versions are those an info job reported as applied above the target version, and every
+// one of them must have an undo-script, so that nothing is undone which was not applied, nor left behind.
+// Flyway community has no undo command, so the scripts are staged as a single afterInfo callback, which flyway runs with
+// placeholders replaced when info is run. The callback ends with removing the undone versions from the history, which
+// only runs when all scripts succeeded, and it runs in a single transaction on databases with transactional DDL.
+// A last info reports the version the database was rolled back to.
+const undoScriptsRollback = `set -eu
+if [ -z "$UNDO_VERSIONS" ]; then
+  echo "no applied versions found above version $ROLLBACK_TARGET_VERSION" >&2
+  exit 1
+fi
+mkdir -p "$UNDO_DIR"
+find "$SQL_DIR" -type f -name "${UNDO_PREFIX}*__*.sql" | while read -r script; do
+  name=$(basename "$script")
+  version=$(echo "${name#"$UNDO_PREFIX"}" | sed 's/__.*//' | tr '_' '.')
+  printf '%s\t%s\n' "$version" "$script"
+done > /tmp/undo-scripts
+callback="$UNDO_DIR/afterInfo__undo.sql"
+: > "$callback"
+versions=""
+for version in $UNDO_VERSIONS; do
+  script=$(awk -F '\t' -v version="$version" '$1 == version { print $2; exit }' /tmp/undo-scripts)
+  if [ -z "$script" ]; then
+    echo "no undo-script found for the applied version $version" >&2
+    exit 1
+  fi
+  echo "undoing version $version with $script" >&2
+  cat "$script" >> "$callback"
+  printf '\n' >> "$callback"
+  versions="$versions${versions:+, }'$version'"
+done
+q="$IDENTIFIER_QUOTE"
+echo "DELETE FROM $q\${flyway:defaultSchema}$q.$q\${flyway:table}$q WHERE ${q}version$q IN ($versions);" >> "$callback"
+flyway info -outputType=json "$CONFIG_FILE_ARG" "-locations=filesystem:$UNDO_DIR" > /tmp/undo.json
+exec flyway info -outputType=json "$CONFIG_FILE_ARG"
+`
+
+// isUndoScriptsRollback returns true if the migration is rolled back by running its undo-scripts.
+func isUndoScriptsRollback(migration *flywayv1alpha1.Migration) bool {
+	return migration.Spec.Rollback != nil && migration.Spec.Rollback.Strategy == flywayv1alpha1.RollbackScripts
+}
+
+// isUndoPlanned returns true if info has reported the versions to undo of all targets at the current generation.
+func isUndoPlanned(migration *flywayv1alpha1.Migration, targets []flywayv1alpha1.DatabaseTarget) bool {
+	return lo.EveryBy(targets, func(target flywayv1alpha1.DatabaseTarget) bool {
+		return getPreviousTargetStatus(migration, target).UndoGeneration == migration.Generation
+	})
+}
+
+// getIdentifierQuote returns the character quoting identifiers in SQL of the database of the JDBC url,
+// MySQL and MariaDB use backticks rather than the double quotes of ANSI SQL.
+func getIdentifierQuote(jdbcUrl string) string {
+	if strings.HasPrefix(jdbcUrl, "jdbc:mysql:") || strings.HasPrefix(jdbcUrl, "jdbc:mariadb:") {
+		return "`"
+	}
+
+	return `"`
+}
+
+// createRollbackJobSpec creates the job rolling the target back to the version of the rollback.
+func createRollbackJobSpec(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) *batchv1.Job {
+	rollback := migration.Spec.Rollback
+	// info reports the version the database was rolled back to
+	job := createCommandJobSpec(migration, target, actionRollback, "undo", "info", "-target="+rollback.TargetVersion)
+	// undoing is not idempotent, a failed rollback must be inspected before it is retried
+	job.Spec.BackoffLimit = ptr.To[int32](0)
+
+	container := &job.Spec.Template.Spec.Containers[0]
+	if rollback.Strategy == flywayv1alpha1.RollbackScripts {
+		container.Command = []string{"sh", "-c", undoScriptsRollback}
+		container.Args = nil
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: rollbackTargetEnvVar, Value: rollback.TargetVersion},
+			corev1.EnvVar{Name: "UNDO_VERSIONS", Value: strings.Join(getPreviousTargetStatus(migration, target).UndoVersions, " ")},
+			corev1.EnvVar{Name: "UNDO_DIR", Value: undoScriptsDir},
+			corev1.EnvVar{Name: "SQL_DIR", Value: flywaySqlPath},
+			corev1.EnvVar{Name: "CONFIG_FILE_ARG", Value: getFlywayConfigFileArg()},
+			corev1.EnvVar{Name: "UNDO_PREFIX", Value: lo.FromPtrOr(migration.Spec.FlywayConfiguration.UndoSqlMigrationPrefix, defaultUndoSqlMigrationPrefix)},
+			corev1.EnvVar{Name: "IDENTIFIER_QUOTE", Value: getIdentifierQuote(target.JdbcUrl)},
+		)
+	}
+
+	return job
+}
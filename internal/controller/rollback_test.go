@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newRollbackMigration(strategy flywayv1alpha1.RollbackStrategy) *flywayv1alpha1.Migration {
+	return &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "some-migration",
+			Namespace:  "some-namespace",
+			Generation: 3,
+		},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			Rollback: &flywayv1alpha1.Rollback{
+				TargetVersion: "1.2",
+				Strategy:      strategy,
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+}
+
+func TestCreateRollbackJobSpec(t *testing.T) {
+	migration := newRollbackMigration(flywayv1alpha1.RollbackUndo)
+	job := createRollbackJobSpec(migration, migration.GetTargets()[0])
+	testhelper.AssertEquals(t, "some-migration-rollback-8fae4a5c", job.Name)
+	testhelper.AssertEquals(t, actionRollback, getJobAction(job))
+	testhelper.AssertEquals(t, int32(0), *job.Spec.BackoffLimit)
+	container := job.Spec.Template.Spec.Containers[0]
+	testhelper.AssertDeepEquals(t, []string{"undo", "info", "-target=1.2", "-outputType=json", "-configFiles=/flyway/operator/flyway.toml"}, container.Args)
+	// the rollback uses the flyway configuration of the migration
+	volume, _ := lo.Find(job.Spec.Template.Spec.Volumes, func(volume corev1.Volume) bool { return volume.Name == flywayConfigVolumeName })
+	testhelper.AssertEquals(t, "some-migration", volume.ConfigMap.Name)
+
+	migration = newRollbackMigration(flywayv1alpha1.RollbackScripts)
+	job = createRollbackJobSpec(migration, migration.GetTargets()[0])
+	container = job.Spec.Template.Spec.Containers[0]
+	testhelper.AssertDeepEquals(t, []string{"sh", "-c", undoScriptsRollback}, container.Command)
+	testhelper.AssertEquals(t, 0, len(container.Args))
+	testhelper.AssertEquals(t, true, lo.Contains(container.Env, corev1.EnvVar{Name: rollbackTargetEnvVar, Value: "1.2"}))
+	testhelper.AssertEquals(t, true, lo.Contains(container.Env, corev1.EnvVar{Name: "UNDO_VERSIONS", Value: ""}))
+	testhelper.AssertEquals(t, true, lo.Contains(container.Env, corev1.EnvVar{Name: "UNDO_PREFIX", Value: "U"}))
+	testhelper.AssertEquals(t, true, lo.Contains(container.Env, corev1.EnvVar{Name: "IDENTIFIER_QUOTE", Value: `"`}))
+
+	// the versions info reported as applied are undone
+	migration.Status.Targets = []flywayv1alpha1.TargetStatus{{Name: flywayv1alpha1.DefaultTarget, UndoVersions: []string{"1.4", "1.3"}}}
+	job = createRollbackJobSpec(migration, migration.GetTargets()[0])
+	container = job.Spec.Template.Spec.Containers[0]
+	testhelper.AssertEquals(t, true, lo.Contains(container.Env, corev1.EnvVar{Name: "UNDO_VERSIONS", Value: "1.4 1.3"}))
+
+	// the configured prefix of undo-scripts, and the quotes of the database, are used
+	migration.Spec.FlywayConfiguration.UndoSqlMigrationPrefix = ptr.To("undo_")
+	migration.Spec.Database.JdbcUrl = "jdbc:mysql://somehost/somedb"
+	job = createRollbackJobSpec(migration, migration.GetTargets()[0])
+	container = job.Spec.Template.Spec.Containers[0]
+	testhelper.AssertEquals(t, true, lo.Contains(container.Env, corev1.EnvVar{Name: "UNDO_PREFIX", Value: "undo_"}))
+	testhelper.AssertEquals(t, true, lo.Contains(container.Env, corev1.EnvVar{Name: "IDENTIFIER_QUOTE", Value: "`"}))
+}
+
+func TestGetIdentifierQuote(t *testing.T) {
+	testhelper.AssertEquals(t, `"`, getIdentifierQuote("jdbc:postgresql://somehost/somedb"))
+	testhelper.AssertEquals(t, `"`, getIdentifierQuote("jdbc:oracle:thin:@somehost:1521/somedb"))
+	testhelper.AssertEquals(t, "`", getIdentifierQuote("jdbc:mysql://somehost/somedb"))
+	testhelper.AssertEquals(t, "`", getIdentifierQuote("jdbc:mariadb://somehost/somedb"))
+}
+
+func TestReconcileRollbackVersion(t *testing.T) {
+	migration := newRollbackMigration(flywayv1alpha1.RollbackScripts)
+	migration.Status.Targets = []flywayv1alpha1.TargetStatus{{Name: flywayv1alpha1.DefaultTarget, CurrentVersion: "1.4"}}
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+	complete := func(name string) {
+		job := &batchv1.Job{}
+		testhelper.AssertNoErr(t, r.GetClient().Get(ctx, types.NamespacedName{Namespace: migration.Namespace, Name: name}, job))
+		job.UID = types.UID(job.Name)
+		testhelper.AssertNoErr(t, r.GetClient().Update(ctx, job))
+		job.Status.Succeeded = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	}
+
+	// info reports the applied versions to undo first
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	r.LogReader = fakeLogReader(`{"operation": "info", "schemaVersion": "1.4", "migrations": [
+  {"version": "1.1", "description": "init", "state": "Success"},
+  {"version": "1.2", "description": "add", "state": "Success"},
+  {"version": "1.3", "description": "alter", "state": "Success"},
+  {"version": "1.4", "description": "drop", "state": "Success"},
+  {"version": "1.5", "description": "next", "state": "Pending"}
+]}`)
+	complete("some-migration-info-150623d9")
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertDeepEquals(t, []string{"1.4", "1.3"}, updated.Status.Targets[0].UndoVersions)
+	testhelper.AssertEquals(t, migration.Generation, updated.Status.Targets[0].UndoGeneration)
+
+	// the rollback undoes those versions, and the info it ends with reports the version the database was rolled back to
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, types.NamespacedName{Namespace: migration.Namespace, Name: "some-migration-rollback-8fae4a5c"}, job))
+	testhelper.AssertEquals(t, true, lo.Contains(job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "UNDO_VERSIONS", Value: "1.4 1.3"}))
+	r.LogReader = fakeLogReader(`undoing version 1.4 with /flyway/sql/U1.4__drop.sql
+undoing version 1.3 with /flyway/sql/U1.3__alter.sql
+{"operation": "info", "schemaVersion": "1.2", "migrations": []}`)
+	complete(job.Name)
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, "1.2", updated.Status.Targets[0].CurrentVersion)
+	testhelper.AssertEquals(t, "1.2", updated.Status.CurrentVersion)
+}
+
+func TestReconcileRollback(t *testing.T) {
+	migration := newRollbackMigration(flywayv1alpha1.RollbackUndo)
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	// the rollback runs instead of the migration
+	jobs := &batchv1.JobList{}
+	testhelper.AssertNoErr(t, r.GetClient().List(ctx, jobs, client.InNamespace(migration.Namespace)))
+	testhelper.AssertEquals(t, 1, len(jobs.Items))
+	testhelper.AssertEquals(t, "some-migration-rollback-8fae4a5c", jobs.Items[0].Name)
+
+	job := &jobs.Items[0]
+	job.Status.Failed = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	for range 2 {
+		_, err = r.Reconcile(ctx, req)
+		testhelper.AssertNoErr(t, err)
+	}
+
+	// a failed rollback is recorded once and not retried
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, 1, len(updated.Status.History))
+	entry := updated.Status.History[0]
+	testhelper.AssertEquals(t, actionRollback, entry.Action)
+	testhelper.AssertEquals(t, flywayv1alpha1.TargetFailed, entry.Result)
+	testhelper.AssertEquals(t, flywayv1alpha1.TargetFailed, updated.Status.Targets[0].Phase)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(job), job))
+	testhelper.AssertEquals(t, int32(1), job.Status.Failed)
+}
+
+func TestRecordHistory(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{}
+	status := &flywayv1alpha1.TargetStatus{Name: flywayv1alpha1.DefaultTarget}
+	for i := range maxHistory + 2 {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "some-job", UID: types.UID(string(rune('a' + i)))}}
+		job.Status.Succeeded = 1
+		testhelper.AssertEquals(t, true, recordHistory(migration, status, job))
+		testhelper.AssertEquals(t, false, recordHistory(migration, status, job))
+	}
+	testhelper.AssertEquals(t, maxHistory, len(migration.Status.History))
+	testhelper.AssertEquals(t, types.UID("c"), migration.Status.History[0].JobUID)
+	testhelper.AssertEquals(t, actionMigrate, migration.Status.History[0].Action)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// isScheduled returns true if changes of the migration wait for its schedule or maintenance windows.
+func isScheduled(migration *flywayv1alpha1.Migration) bool {
+	return migration.Spec.Schedule != "" || len(migration.Spec.MaintenanceWindows) > 0
+}
+
+// reconcileSchedule decides whether jobs changing the databases may be submitted now, when some are waiting to be.
+// Once a change is seen, it is planned for the next time of the schedule, or the opening of the next maintenance window,
+// which is reported in the status. It returns whether the jobs may be submitted, and otherwise when to check again.
+func reconcileSchedule(migration *flywayv1alpha1.Migration, waiting bool, now time.Time) (bool, time.Duration, error) {
+	if !isScheduled(migration) || !waiting {
+		migration.Status.NextScheduledRun = nil
+		return true, 0, nil
+	}
+
+	if migration.Spec.Schedule != "" {
+		schedule, err := cron.ParseStandard(migration.Spec.Schedule)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid schedule %q: %w", migration.Spec.Schedule, err)
+		}
+		// the run is planned once, so that it is not postponed by every later reconcile
+		if migration.Status.NextScheduledRun == nil {
+			migration.Status.NextScheduledRun = &metav1.Time{Time: schedule.Next(now)}
+		}
+		next := migration.Status.NextScheduledRun.Time
+
+		return !now.Before(next), next.Sub(now), nil
+	}
+
+	var next time.Time
+	for _, window := range migration.Spec.MaintenanceWindows {
+		schedule, err := cron.ParseStandard(window.Schedule)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid maintenance window schedule %q: %w", window.Schedule, err)
+		}
+		// the last opening of the window, if it is still open, otherwise the next one
+		opening := schedule.Next(now.Add(-window.Duration.Duration))
+		if !opening.After(now) {
+			migration.Status.NextScheduledRun = nil
+			return true, 0, nil
+		}
+		if next.IsZero() || opening.Before(next) {
+			next = opening
+		}
+	}
+	migration.Status.NextScheduledRun = &metav1.Time{Time: next}
+
+	return false, next.Sub(now), nil
+}
+
+// setTargetsScheduled flags the targets waiting for the planned run.
+func setTargetsScheduled(statuses []flywayv1alpha1.TargetStatus, migration *flywayv1alpha1.Migration, waiting []flywayv1alpha1.DatabaseTarget) {
+	for _, target := range waiting {
+		for i := range statuses {
+			if statuses[i].Name != target.Name {
+				continue
+			}
+			next := migration.Status.NextScheduledRun.UTC().Format(time.RFC3339)
+			if statuses[i].Phase == flywayv1alpha1.TargetFailed {
+				statuses[i].Message = fmt.Sprintf("retrying at %s after failure: %s", next, statuses[i].Message)
+			} else {
+				statuses[i].Message = fmt.Sprintf("scheduled to run at %s", next)
+			}
+		}
+	}
+}
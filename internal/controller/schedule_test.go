@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileScheduleCron(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{Spec: flywayv1alpha1.MigrationSpec{Schedule: "0 2 * * *"}}
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	next := time.Date(2023, 6, 2, 2, 0, 0, 0, time.UTC)
+
+	open, after, err := reconcileSchedule(migration, true, now)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, false, open)
+	testhelper.AssertEquals(t, 14*time.Hour, after)
+	testhelper.AssertEquals(t, next, migration.Status.NextScheduledRun.Time)
+
+	// the planned run is kept, even when it is missed by some minutes
+	open, _, err = reconcileSchedule(migration, true, next.Add(5*time.Minute))
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, open)
+	testhelper.AssertEquals(t, next, migration.Status.NextScheduledRun.Time)
+
+	open, _, err = reconcileSchedule(migration, false, now)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, open)
+	testhelper.AssertEquals(t, true, migration.Status.NextScheduledRun == nil)
+
+	migration.Spec.Schedule = "not a schedule"
+	_, _, err = reconcileSchedule(migration, true, now)
+	testhelper.AssertErr(t, err)
+}
+
+func TestReconcileScheduleMaintenanceWindows(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{Spec: flywayv1alpha1.MigrationSpec{
+		MaintenanceWindows: []flywayv1alpha1.MaintenanceWindow{
+			{Schedule: "0 22 * * *", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			{Schedule: "0 12 * * 6", Duration: metav1.Duration{Duration: time.Hour}},
+		},
+	}}
+
+	// thursday
+	open, after, err := reconcileSchedule(migration, true, time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, false, open)
+	testhelper.AssertEquals(t, 10*time.Hour, after)
+	testhelper.AssertEquals(t, time.Date(2023, 6, 1, 22, 0, 0, 0, time.UTC), migration.Status.NextScheduledRun.Time)
+
+	// open past midnight
+	open, _, err = reconcileSchedule(migration, true, time.Date(2023, 6, 2, 1, 30, 0, 0, time.UTC))
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, open)
+	testhelper.AssertEquals(t, true, migration.Status.NextScheduledRun == nil)
+
+	// saturday, the weekend window opens first
+	open, _, err = reconcileSchedule(migration, true, time.Date(2023, 6, 3, 8, 0, 0, 0, time.UTC))
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, false, open)
+	testhelper.AssertEquals(t, time.Date(2023, 6, 3, 12, 0, 0, 0, time.UTC), migration.Status.NextScheduledRun.Time)
+}
+
+func TestReconcileScheduled(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			Schedule: "0 2 * * *",
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	result, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, true, result.RequeueAfter > 0)
+	err = r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), &batchv1.Job{})
+	testhelper.AssertEquals(t, true, err != nil)
+
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, updated.Status.NextScheduledRun != nil)
+	testhelper.AssertEquals(t, flywayv1alpha1.TargetPending, updated.Status.Targets[0].Phase)
+
+	// the planned run is due
+	updated.Status.NextScheduledRun = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, updated))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), &batchv1.Job{}))
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, updated.Status.NextScheduledRun == nil)
+}
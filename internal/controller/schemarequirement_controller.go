@@ -0,0 +1,120 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/redhat-cop/operator-utils/pkg/util"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SchemaRequirementReconciler reconciles a SchemaRequirement object
+type SchemaRequirementReconciler struct {
+	util.ReconcilerBase
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=schemarequirements,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=schemarequirements/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=flyway.davidkarlsen.com,resources=schemarequirements/finalizers,verbs=update
+
+// Reconcile reports whether the databases of the referenced migration have reached the required schema version.
+func (r *SchemaRequirementReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	requirement := &flywayv1alpha1.SchemaRequirement{}
+	if err := r.Get(ctx, req.NamespacedName, requirement); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if util.IsBeingDeleted(requirement) {
+		return ctrl.Result{}, nil
+	}
+
+	key := requirement.Spec.MigrationRef.GetNamespacedName(requirement.Namespace)
+	migration := &flywayv1alpha1.Migration{}
+	err := r.Get(ctx, key, migration)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return r.ManageError(ctx, requirement, err)
+	}
+
+	condition := metav1.Condition{
+		Type:               flywayv1alpha1.ConditionRequirementMet,
+		ObservedGeneration: requirement.Generation,
+		Status:             metav1.ConditionFalse,
+	}
+	requirement.Status.CurrentVersion = migration.Status.CurrentVersion
+	switch {
+	case apierrors.IsNotFound(err):
+		condition.Reason = "MigrationNotFound"
+		condition.Message = fmt.Sprintf("migration %s not found", key)
+	case !migration.HasReachedVersion(requirement.Spec.MinVersion):
+		condition.Reason = "VersionNotReached"
+		condition.Message = fmt.Sprintf("migration %s is at version %s, %s is required", key,
+			lo.CoalesceOrEmpty(migration.Status.CurrentVersion, "unknown"), requirement.Spec.MinVersion)
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "VersionReached"
+		condition.Message = fmt.Sprintf("migration %s is at version %s", key, migration.Status.CurrentVersion)
+	}
+
+	previous := meta.FindStatusCondition(requirement.Status.Conditions, flywayv1alpha1.ConditionRequirementMet)
+	if previous == nil || previous.Status != condition.Status {
+		log.FromContext(ctx).Info("Schema requirement changed", "requirement", req.NamespacedName, "met", condition.Status)
+		eventType, reason := corev1.EventTypeWarning, "RequirementNotMet"
+		if condition.Status == metav1.ConditionTrue {
+			eventType, reason = corev1.EventTypeNormal, "RequirementMet"
+		}
+		r.GetRecorder().Event(requirement, eventType, reason, condition.Message)
+	}
+	meta.SetStatusCondition(&requirement.Status.Conditions, condition)
+
+	return r.ManageSuccess(ctx, requirement)
+}
+
+// findRequirementsForMigration maps a migration to the schema requirements referencing it.
+func (r *SchemaRequirementReconciler) findRequirementsForMigration(ctx context.Context, migration client.Object) []reconcile.Request {
+	requirements := &flywayv1alpha1.SchemaRequirementList{}
+	if err := r.GetClient().List(ctx, requirements); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list schema requirements")
+		return nil
+	}
+
+	return lo.FilterMap(requirements.Items, func(requirement flywayv1alpha1.SchemaRequirement, _ int) (reconcile.Request, bool) {
+		return reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&requirement)},
+			requirement.Spec.MigrationRef.GetNamespacedName(requirement.Namespace) == client.ObjectKeyFromObject(migration)
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SchemaRequirementReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&flywayv1alpha1.SchemaRequirement{}).
+		Watches(&flywayv1alpha1.Migration{}, handler.EnqueueRequestsFromMapFunc(r.findRequirementsForMigration)).
+		Complete(r)
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileSchemaRequirement(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "shared"},
+		Status:     flywayv1alpha1.MigrationStatus{CurrentVersion: "1.9"},
+	}
+	requirement := &flywayv1alpha1.SchemaRequirement{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-app", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.SchemaRequirementSpec{
+			MigrationRef: flywayv1alpha1.MigrationReference{Name: migration.Name, Namespace: migration.Namespace},
+			MinVersion:   "2",
+		},
+	}
+
+	ctx := context.TODO()
+	base := newTestReconciler(migration, requirement)
+	r := &SchemaRequirementReconciler{ReconcilerBase: base.ReconcilerBase, Client: base.Client, Scheme: base.Scheme}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(requirement)}
+	recorder := base.Recorder.(*events.FakeRecorder)
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	updated := &flywayv1alpha1.SchemaRequirement{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, false, updated.IsMet())
+	testhelper.AssertEquals(t, "1.9", updated.Status.CurrentVersion)
+	condition := meta.FindStatusCondition(updated.Status.Conditions, flywayv1alpha1.ConditionRequirementMet)
+	testhelper.AssertEquals(t, "migration shared/some-migration is at version 1.9, 2 is required", condition.Message)
+	testhelper.AssertEquals(t, "Warning RequirementNotMet migration shared/some-migration is at version 1.9, 2 is required", <-recorder.Events)
+
+	testhelper.AssertDeepEquals(t, []reconcile.Request{req}, r.findRequirementsForMigration(ctx, migration))
+
+	// the event is only emitted when the requirement changes
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, 0, len(recorder.Events))
+
+	migration.Status.CurrentVersion = "2.0.1"
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, migration))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, updated.IsMet())
+	testhelper.AssertEquals(t, "2.0.1", updated.Status.CurrentVersion)
+	testhelper.AssertEquals(t, "Normal RequirementMet migration shared/some-migration is at version 2.0.1", <-recorder.Events)
+
+	testhelper.AssertNoErr(t, r.GetClient().Delete(ctx, migration))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, false, updated.IsMet())
+	testhelper.AssertEquals(t, "MigrationNotFound", meta.FindStatusCondition(updated.Status.Conditions, flywayv1alpha1.ConditionRequirementMet).Reason)
+}
@@ -74,10 +74,12 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).ToNot(HaveOccurred())
 
+	recorder := k8sManager.GetEventRecorder("Migration")
 	err = (&MigrationReconciler{
-		ReconcilerBase: util.NewFromManager(k8sManager, k8sManager.GetEventRecorderFor("Migration")), //nolint:staticcheck // SA1019 - GetEventRecorderFor is deprecated
+		ReconcilerBase: util.NewFromManager(k8sManager, NewEventRecorder(recorder, k8sManager.GetClient(), "Migration")),
 		Client:         k8sManager.GetClient(),
 		Scheme:         k8sManager.GetScheme(),
+		Recorder:       recorder,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
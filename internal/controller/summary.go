@@ -0,0 +1,116 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// setSummary reports the counters and the summary shown by kubectl and dashboards.
+func setSummary(migration *flywayv1alpha1.Migration) {
+	migration.Status.PendingCount = int32(lo.SumBy(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) int {
+		return len(status.PendingMigrations)
+	}))
+	if entry, found := lo.Last(migration.Status.History); found {
+		migration.Status.LastRunTime = entry.CompletionTime
+	}
+	migration.Status.Summary = getSummary(migration)
+}
+
+// getSummary describes the state of the migration in a line, the most pressing state first.
+func getSummary(migration *flywayv1alpha1.Migration) string {
+	conditions := migration.Status.Conditions
+	failed := lo.CountBy(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) bool {
+		return status.Phase == flywayv1alpha1.TargetFailed
+	})
+	total := len(migration.Status.Targets)
+
+	stalled := meta.FindStatusCondition(conditions, flywayv1alpha1.ConditionStalled)
+
+	switch {
+	case stalled != nil && stalled.Status == metav1.ConditionTrue && stalled.Reason == reasonReconcileError:
+		return "Error: " + stalled.Message
+	case migration.IsPaused() && !migration.Spec.DryRun:
+		return "Paused"
+	case migration.Annotations[flywayv1alpha1.Action] != "":
+		return fmt.Sprintf("Running %s", migration.Annotations[flywayv1alpha1.Action])
+	case failed > 0:
+		return fmt.Sprintf("Failed: %d of %d databases failed", failed, total)
+	case meta.IsStatusConditionTrue(conditions, flywayv1alpha1.ConditionDrifted):
+		return "Drifted: " + meta.FindStatusCondition(conditions, flywayv1alpha1.ConditionDrifted).Message
+	case meta.IsStatusConditionTrue(conditions, flywayv1alpha1.ConditionPendingApproval):
+		return fmt.Sprintf("Awaiting approval of %d pending migrations", migration.Status.PendingCount)
+	case meta.IsStatusConditionFalse(conditions, flywayv1alpha1.ConditionDependenciesReady):
+		return "Waiting for dependencies: " + meta.FindStatusCondition(conditions, flywayv1alpha1.ConditionDependenciesReady).Message
+	case meta.IsStatusConditionTrue(conditions, flywayv1alpha1.ConditionWaitingForLock):
+		return "Waiting for lock: " + meta.FindStatusCondition(conditions, flywayv1alpha1.ConditionWaitingForLock).Message
+	case migration.IsReady():
+		return fmt.Sprintf("Applied version %s to %d databases", lo.CoalesceOrEmpty(migration.Status.CurrentVersion, "unknown"), total)
+	case migration.Status.NextScheduledRun != nil:
+		return fmt.Sprintf("Scheduled to run at %s", migration.Status.NextScheduledRun.UTC().Format(time.RFC3339))
+	}
+
+	if condition := meta.FindStatusCondition(conditions, flywayv1alpha1.ConditionReady); condition != nil {
+		return fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+	}
+	return "Pending"
+}
+
+// observeSource reports the image the job applied the migrations from, by the digest its pod ran when the pod is
+// still around.
+func (r *MigrationReconciler) observeSource(ctx context.Context, migration *flywayv1alpha1.Migration, job *batchv1.Job) {
+	pod, err := r.getLatestJobPod(ctx, job)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to read the pod of the job, reporting the source without digest", "job", job.Name)
+	}
+	migration.Status.Source = getSource(job, pod)
+}
+
+// getSource returns the image of the migrations of the job, by digest when the pod reports it.
+func getSource(job *batchv1.Job, pod *corev1.Pod) string {
+	container, _ := lo.Find(job.Spec.Template.Spec.InitContainers, func(container corev1.Container) bool {
+		return container.Name == copySqlContainerName
+	})
+	if pod == nil {
+		return container.Image
+	}
+
+	status, found := lo.Find(pod.Status.InitContainerStatuses, func(status corev1.ContainerStatus) bool {
+		return status.Name == copySqlContainerName
+	})
+	// the container runtime may prefix the reference, like docker-pullable://
+	_, imageID, prefixed := strings.Cut(status.ImageID, "://")
+	if !prefixed {
+		imageID = status.ImageID
+	}
+	if !found || !strings.Contains(imageID, "@") {
+		return container.Image
+	}
+
+	return imageID
+}
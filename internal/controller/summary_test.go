@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestGetSummary(t *testing.T) {
+	ready := metav1.Condition{Type: flywayv1alpha1.ConditionReady, Status: metav1.ConditionTrue, Reason: "Succeeded"}
+	progressing := metav1.Condition{Type: flywayv1alpha1.ConditionReady, Status: metav1.ConditionFalse, Reason: "Progressing",
+		Message: "1 of 2 databases migrated"}
+	targets := []flywayv1alpha1.TargetStatus{
+		{Name: "tenant-a", Phase: flywayv1alpha1.TargetSucceeded},
+		{Name: "tenant-b", Phase: flywayv1alpha1.TargetSucceeded},
+	}
+	failedTargets := []flywayv1alpha1.TargetStatus{
+		{Name: "tenant-a", Phase: flywayv1alpha1.TargetSucceeded},
+		{Name: "tenant-b", Phase: flywayv1alpha1.TargetFailed},
+	}
+
+	for name, test := range map[string]struct {
+		annotations map[string]string
+		status      flywayv1alpha1.MigrationStatus
+		expected    string
+	}{
+		"not reconciled": {expected: "Pending"},
+		"applied": {
+			status:   flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{ready}, Targets: targets, CurrentVersion: "1.3"},
+			expected: "Applied version 1.3 to 2 databases",
+		},
+		"progressing": {
+			status:   flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{progressing}, Targets: targets},
+			expected: "Progressing: 1 of 2 databases migrated",
+		},
+		"failed": {
+			status:   flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{progressing}, Targets: failedTargets},
+			expected: "Failed: 1 of 2 databases failed",
+		},
+		"paused": {
+			annotations: map[string]string{flywayv1alpha1.Paused: "true"},
+			status:      flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{progressing}, Targets: failedTargets},
+			expected:    "Paused",
+		},
+		"repairing": {
+			annotations: map[string]string{flywayv1alpha1.Action: actionRepair},
+			status:      flywayv1alpha1.MigrationStatus{Conditions: []metav1.Condition{ready}, Targets: targets},
+			expected:    "Running repair",
+		},
+		"awaiting approval": {
+			status: flywayv1alpha1.MigrationStatus{
+				Conditions: []metav1.Condition{progressing,
+					{Type: flywayv1alpha1.ConditionPendingApproval, Status: metav1.ConditionTrue, Reason: "AwaitingApproval"}},
+				Targets:      targets,
+				PendingCount: 3,
+			},
+			expected: "Awaiting approval of 3 pending migrations",
+		},
+		"waiting for lock": {
+			status: flywayv1alpha1.MigrationStatus{
+				Conditions: []metav1.Condition{progressing,
+					{Type: flywayv1alpha1.ConditionWaitingForLock, Status: metav1.ConditionTrue, Reason: "DatabaseLocked",
+						Message: "waiting for the lock of tenant-b, held by other-job"}},
+				Targets: targets,
+			},
+			expected: "Waiting for lock: waiting for the lock of tenant-b, held by other-job",
+		},
+		"scheduled": {
+			status: flywayv1alpha1.MigrationStatus{
+				Conditions:       []metav1.Condition{progressing},
+				Targets:          targets,
+				NextScheduledRun: &metav1.Time{Time: time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)},
+			},
+			expected: "Scheduled to run at 2024-01-01T02:00:00Z",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			migration := &flywayv1alpha1.Migration{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}, Status: test.status}
+			testhelper.AssertEquals(t, test.expected, getSummary(migration))
+		})
+	}
+}
+
+func TestGetSource(t *testing.T) {
+	job := &batchv1.Job{Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: copySqlContainerName, Image: "somereg.io/someimage:sometag"}},
+	}}}}
+	pod := func(imageID string) *corev1.Pod {
+		return &corev1.Pod{Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{Name: copySqlContainerName, ImageID: imageID}},
+		}}
+	}
+	const digest = "somereg.io/someimage@sha256:0123456789abcdef"
+
+	testhelper.AssertEquals(t, "somereg.io/someimage:sometag", getSource(job, nil))
+	testhelper.AssertEquals(t, "somereg.io/someimage:sometag", getSource(job, pod("")))
+	testhelper.AssertEquals(t, digest, getSource(job, pod(digest)))
+	testhelper.AssertEquals(t, digest, getSource(job, pod("docker-pullable://"+digest)))
+}
+
+func TestReconcileSummary(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			FlywayConfiguration: flywayv1alpha1.FlywayConfiguration{
+				Target: ptr.To("1.3"),
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(compositeOutput)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, "Progressing: 0 of 1 databases migrated", updated.Status.Summary)
+
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+	completed := metav1.Now()
+	job.Status.Succeeded = 1
+	job.Status.CompletionTime = &completed
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, "Applied version 1.3 to 1 databases", updated.Status.Summary)
+	testhelper.AssertEquals(t, "somereg.io/someimage:sometag", updated.Status.Source)
+	testhelper.AssertEquals(t, completed.Unix(), updated.Status.LastRunTime.Unix())
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// getJobGeneration returns the generation of the migration the job was created for.
+func getJobGeneration(job *batchv1.Job) int64 {
+	generation, _ := strconv.ParseInt(job.Annotations[flywayv1alpha1.Generation], 10, 64)
+	return generation
+}
+
+// getJobFailure returns the reason flagged by kubernetes for a failed job.
+func getJobFailure(job *batchv1.Job) string {
+	condition, found := lo.Find(job.Status.Conditions, func(condition batchv1.JobCondition) bool {
+		return condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue
+	})
+	if !found {
+		return "job failed"
+	}
+
+	return fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+}
+
+// getTargetStatus derives the state of the migration of a target from its job.
+func getTargetStatus(target flywayv1alpha1.DatabaseTarget, jobName string, job *batchv1.Job) flywayv1alpha1.TargetStatus {
+	status := flywayv1alpha1.TargetStatus{
+		Name:    target.Name,
+		JobName: jobName,
+		Phase:   flywayv1alpha1.TargetPending,
+	}
+	if job == nil {
+		return status
+	}
+
+	status.Generation = getJobGeneration(job)
+	switch {
+	case !isJobFinished(job):
+		status.Phase = flywayv1alpha1.TargetRunning
+	case hasFailed(job):
+		status.Phase = flywayv1alpha1.TargetFailed
+		status.Message = getJobFailure(job)
+	case hasSucceeded(job):
+		status.Phase = flywayv1alpha1.TargetSucceeded
+	}
+
+	return status
+}
+
+// setTargetSubmitted flags the target as running a new job, keeping the reason of any previous failure.
+func setTargetSubmitted(statuses []flywayv1alpha1.TargetStatus, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) {
+	for i := range statuses {
+		if statuses[i].Name != target.Name {
+			continue
+		}
+		if statuses[i].Phase == flywayv1alpha1.TargetFailed {
+			statuses[i].Message = fmt.Sprintf("retrying after failure: %s", statuses[i].Message)
+		} else {
+			statuses[i].Message = ""
+		}
+		statuses[i].Phase = flywayv1alpha1.TargetRunning
+		statuses[i].Generation = migration.Generation
+	}
+}
+
+// setReadyCondition aggregates the state of all targets running the action into the Ready condition.
+func setReadyCondition(migration *flywayv1alpha1.Migration, action string) {
+	succeeded := lo.CountBy(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) bool {
+		return status.Phase == flywayv1alpha1.TargetSucceeded && status.Generation == migration.Generation
+	})
+	total := len(migration.Status.Targets)
+	done := map[string]string{
+		actionMigrate:  "migrated",
+		actionDryRun:   "previewed",
+		actionRollback: "rolled back",
+		actionInfo:     "checked for pending migrations",
+	}[action]
+	if action == actionInfo && migration.Spec.Rollback != nil {
+		done = "checked for the versions to undo"
+	}
+
+	condition := metav1.Condition{
+		Type:               flywayv1alpha1.ConditionReady,
+		ObservedGeneration: migration.Generation,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Progressing",
+		Message:            fmt.Sprintf("%d of %d databases %s", succeeded, total, done),
+	}
+	switch {
+	case total == 0:
+		condition.Reason = "NoDatabases"
+		condition.Message = "no databases selected"
+	case action == actionInfo:
+		// the migrations have yet to be applied
+	case action == actionDryRun:
+		// a preview leaves the migrations to be applied, so what depends on them must keep waiting
+		condition.Reason = "DryRun"
+	case succeeded == total:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Succeeded"
+	}
+	meta.SetStatusCondition(&migration.Status.Conditions, condition)
+}
+
+func isReady(migration *flywayv1alpha1.Migration) bool {
+	return meta.IsStatusConditionTrue(migration.Status.Conditions, flywayv1alpha1.ConditionReady)
+}
+
+// getPreviousTargetStatus returns the status last reported for the target.
+func getPreviousTargetStatus(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) flywayv1alpha1.TargetStatus {
+	status, _ := lo.Find(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) bool { return status.Name == target.Name })
+	return status
+}
+
+// getTargetStatusRef returns the status of the target in the migration, adding it when the target has none yet.
+func getTargetStatusRef(migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget) *flywayv1alpha1.TargetStatus {
+	index := slices.IndexFunc(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) bool { return status.Name == target.Name })
+	if index < 0 {
+		migration.Status.Targets = append(migration.Status.Targets, flywayv1alpha1.TargetStatus{Name: target.Name})
+		index = len(migration.Status.Targets) - 1
+	}
+
+	return &migration.Status.Targets[index]
+}
+
+// keepObservations carries what was observed about the target by earlier runs over to its new status.
+func keepObservations(status *flywayv1alpha1.TargetStatus, previous flywayv1alpha1.TargetStatus) {
+	status.CurrentVersion = previous.CurrentVersion
+	status.PendingMigrations = previous.PendingMigrations
+	status.DryRunConfigMap = previous.DryRunConfigMap
+	status.Drift = previous.Drift
+	status.CleanedGeneration = previous.CleanedGeneration
+	status.RecordedJobs = previous.RecordedJobs
+	status.UndoVersions = previous.UndoVersions
+	status.UndoGeneration = previous.UndoGeneration
+}
+
+// observeOutput reads what flyway reported in the output of a succeeded job into the status of the target.
+func (r *MigrationReconciler) observeOutput(ctx context.Context, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget,
+	job *batchv1.Job, status *flywayv1alpha1.TargetStatus) error {
+	// the pending migrations must be known to be approved, for other jobs the output is informational
+	required := getJobAction(job) == actionInfo
+	if r.LogReader == nil {
+		if required {
+			return errors.New("the output of jobs cannot be read, which approval requires")
+		}
+		return nil
+	}
+
+	logger := log.FromContext(ctx)
+	output, err := r.LogReader.ReadLog(ctx, job)
+	if err != nil {
+		if required {
+			return fmt.Errorf("unable to read the output of job %s: %w", job.Name, err)
+		}
+		logger.Error(err, "unable to read the output of the job", "job", job.Name)
+		return nil
+	}
+	results, err := parseFlywayOutput(output)
+	if err != nil {
+		if required {
+			return fmt.Errorf("unable to parse the output of job %s: %w", job.Name, err)
+		}
+		logger.Error(err, "unable to parse the output of the job", "job", job.Name)
+		return nil
+	}
+
+	status.CurrentVersion, _ = lo.Coalesce(getSchemaVersion(results), status.CurrentVersion)
+	pending, found := getPendingMigrations(results)
+	if found {
+		status.PendingMigrations = pending
+	} else if required {
+		return fmt.Errorf("job %s did not report the pending migrations", job.Name)
+	}
+	if getJobAction(job) == actionDryRun {
+		return r.saveDryRun(ctx, migration, target, job, pending, output, status)
+	}
+	if getJobAction(job) == actionInfo && isUndoScriptsRollback(migration) {
+		status.UndoVersions = getVersionsToUndo(results, migration.Spec.Rollback.TargetVersion)
+		status.UndoGeneration = getJobGeneration(job)
+	}
+
+	return nil
+}
+
+// setVersions reports the requested version, and the lowest version reached by the targets once all have reported one.
+func setVersions(migration *flywayv1alpha1.Migration) {
+	migration.Status.RequestedVersion = migration.GetRequestedVersion()
+	versions := lo.Map(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus, _ int) string { return status.CurrentVersion })
+	if lo.Contains(versions, "") {
+		migration.Status.CurrentVersion = ""
+		return
+	}
+	migration.Status.CurrentVersion = flywayv1alpha1.MinVersion(versions...)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/davidkarlsen/flyway-operator/internal/tracing"
+	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// migrationAttributes returns the span attributes identifying the migration.
+func migrationAttributes(migration *flywayv1alpha1.Migration) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("migration.namespace", migration.Namespace),
+		attribute.String("migration.name", migration.Name),
+		attribute.Int64("migration.generation", migration.Generation),
+	}
+}
+
+// endSpan ends the span, recording the error, if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceJob records the lifecycle of a finished job after the fact, as it spans many reconciles:
+// from its creation, through the scheduling of its pod and the copy-sql init container, until flyway finished.
+// The span continues the trace of the reconcile which submitted the job.
+func (r *MigrationReconciler) traceJob(ctx context.Context, migration *flywayv1alpha1.Migration, target flywayv1alpha1.DatabaseTarget, job *batchv1.Job) {
+	tracer := tracing.Tracer()
+	attributes := append(migrationAttributes(migration),
+		attribute.String("migration.target", target.Name),
+		attribute.String("migration.action", getJobAction(job)),
+		attribute.String("job.name", job.Name),
+	)
+	jobCtx, span := tracer.Start(tracing.Extract(ctx, job.Annotations), "Job",
+		trace.WithTimestamp(job.CreationTimestamp.Time), trace.WithAttributes(attributes...))
+	if hasFailed(job) {
+		span.SetStatus(codes.Error, getJobFailure(job))
+	}
+	end := time.Now()
+	if completionTime := getJobCompletionTime(job); completionTime != nil {
+		end = completionTime.Time
+	}
+	defer span.End(trace.WithTimestamp(end))
+
+	pod, err := r.getLatestJobPod(ctx, job)
+	if err != nil || pod == nil {
+		log.FromContext(ctx).V(1).Info("Not tracing the pod of the job", "job", job.Name, "error", err)
+		return
+	}
+	if condition, found := lo.Find(pod.Status.Conditions, func(condition corev1.PodCondition) bool {
+		return condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionTrue
+	}); found {
+		_, scheduled := tracer.Start(jobCtx, "PodScheduled",
+			trace.WithTimestamp(pod.CreationTimestamp.Time), trace.WithAttributes(attribute.String("pod.name", pod.Name)))
+		scheduled.End(trace.WithTimestamp(condition.LastTransitionTime.Time))
+	}
+	for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if terminated == nil {
+			continue
+		}
+		_, container := tracer.Start(jobCtx, status.Name, trace.WithTimestamp(terminated.StartedAt.Time),
+			trace.WithAttributes(attribute.String("container.name", status.Name), attribute.Int("container.exit_code", int(terminated.ExitCode))))
+		if terminated.ExitCode != 0 {
+			container.SetStatus(codes.Error, terminated.Reason)
+		}
+		container.End(trace.WithTimestamp(terminated.FinishedAt.Time))
+	}
+}
+
+// getLatestJobPod returns the most recent pod of the job, if any.
+// The API is read directly, as pods are not cached.
+func (r *MigrationReconciler) getLatestJobPod(ctx context.Context, job *batchv1.Job) (*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := r.GetAPIReader().List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, nil
+	}
+
+	pod := slices.MaxFunc(pods.Items, func(a, b corev1.Pod) int {
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+	return &pod, nil
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestTraceJob(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(migration)
+	r.LogReader = fakeLogReader(compositeOutput)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(migration)}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+	submit, found := lo.Find(exporter.GetSpans(), func(span tracetest.SpanStub) bool { return span.Name == "SubmitJob" })
+	testhelper.AssertEquals(t, true, found)
+	testhelper.AssertEquals(t, "Reconcile", exporter.GetSpans()[len(exporter.GetSpans())-1].Name)
+	testhelper.AssertEquals(t, true, job.Annotations["traceparent"] != "")
+
+	created := time.Now().Add(-time.Minute).Truncate(time.Second)
+	terminated := func(start, finish time.Duration) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			StartedAt:  metav1.NewTime(created.Add(start)),
+			FinishedAt: metav1.NewTime(created.Add(finish)),
+		}}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "some-migration-abcde",
+			Namespace:         migration.Namespace,
+			Labels:            map[string]string{batchv1.JobNameLabel: job.Name},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{
+				Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(created.Add(2 * time.Second)),
+			}},
+			InitContainerStatuses: []corev1.ContainerStatus{{Name: "copy-sql", State: terminated(5*time.Second, 6*time.Second)}},
+			ContainerStatuses:     []corev1.ContainerStatus{{Name: flywayContainerName, State: terminated(7*time.Second, 40*time.Second)}},
+		},
+	}
+	testhelper.AssertNoErr(t, r.GetClient().Create(ctx, pod))
+	completion := metav1.NewTime(created.Add(41 * time.Second))
+	job.Status.Succeeded = 1
+	job.Status.CompletionTime = &completion
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	exporter.Reset()
+
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	// the lifecycle of the job continues the trace of its submit
+	spans := lo.SliceToMap(exporter.GetSpans(), func(span tracetest.SpanStub) (string, tracetest.SpanStub) { return span.Name, span })
+	jobSpan := spans["Job"]
+	testhelper.AssertEquals(t, submit.SpanContext.TraceID(), jobSpan.SpanContext.TraceID())
+	testhelper.AssertEquals(t, submit.SpanContext.SpanID(), jobSpan.Parent.SpanID())
+	testhelper.AssertEquals(t, completion.Time, jobSpan.EndTime)
+	for _, name := range []string{"PodScheduled", "copy-sql", flywayContainerName} {
+		testhelper.AssertEquals(t, jobSpan.SpanContext.SpanID(), spans[name].Parent.SpanID())
+	}
+	testhelper.AssertEquals(t, created.Add(2*time.Second), spans["PodScheduled"].EndTime)
+	testhelper.AssertEquals(t, 33*time.Second, spans[flywayContainerName].EndTime.Sub(spans[flywayContainerName].StartTime))
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// replicasAnnotation keeps the replicas of a workload scaled down by a migration, to scale it back up to
+	replicasAnnotation = flywayv1alpha1.Prefix + "/" + "replicas"
+	// workloadRetryInterval is how often the pods of workloads being scaled down are checked again
+	workloadRetryInterval = 10 * time.Second
+	// workloadsFinalizer keeps a migration which scaled down workloads until they have been scaled back up
+	workloadsFinalizer = flywayv1alpha1.Prefix + "/" + "scale-up-workloads"
+)
+
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;patch
+
+// getWorkload reads the referenced workload, it returns nil when the workload does not exist.
+// Workloads are read directly, rather than from a cache holding all workloads of the cluster.
+func (r *MigrationReconciler) getWorkload(ctx context.Context, namespace string, ref flywayv1alpha1.WorkloadReference) (client.Object, error) {
+	var workload client.Object
+	switch ref.Kind {
+	case "Deployment":
+		workload = &appsv1.Deployment{}
+	case "StatefulSet":
+		workload = &appsv1.StatefulSet{}
+	default:
+		return nil, fmt.Errorf("unsupported workload kind %s", ref.Kind)
+	}
+
+	err := r.GetAPIReader().Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, workload)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+
+	return workload, err
+}
+
+// getWorkloadReplicas returns the desired replicas of the workload, and the pods it still runs.
+func getWorkloadReplicas(workload client.Object) (**int32, int32) {
+	switch workload := workload.(type) {
+	case *appsv1.Deployment:
+		return &workload.Spec.Replicas, workload.Status.Replicas
+	case *appsv1.StatefulSet:
+		return &workload.Spec.Replicas, workload.Status.Replicas
+	}
+
+	return nil, 0
+}
+
+// scaleDownWorkloads scales the workloads of the migration down to zero, keeping their replicas to scale them back up to.
+// It returns whether all pods of the workloads are gone.
+func (r *MigrationReconciler) scaleDownWorkloads(ctx context.Context, migration *flywayv1alpha1.Migration) (bool, error) {
+	// the workloads are scaled back up should the migration be deleted while they are down
+	if err := r.setWorkloadsFinalizer(ctx, migration, true); err != nil {
+		return false, err
+	}
+
+	down := true
+	for _, ref := range migration.Spec.WorkloadRefs {
+		workload, err := r.getWorkload(ctx, migration.Namespace, ref)
+		if err != nil {
+			return false, err
+		}
+		if workload == nil {
+			log.FromContext(ctx).Info("Workload not found, not scaling it down", "kind", ref.Kind, "name", ref.Name)
+			continue
+		}
+
+		replicas, running := getWorkloadReplicas(workload)
+		if _, scaledDown := workload.GetAnnotations()[replicasAnnotation]; !scaledDown {
+			patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+			workload.SetAnnotations(lo.Assign(workload.GetAnnotations(), map[string]string{
+				replicasAnnotation: strconv.Itoa(int(ptr.Deref(*replicas, 1))),
+			}))
+			*replicas = ptr.To[int32](0)
+			if err := r.GetClient().Patch(ctx, workload, patch); err != nil {
+				return false, err
+			}
+			r.GetRecorder().Event(migration, corev1.EventTypeNormal, "ScaledDown",
+				fmt.Sprintf("Scaled down %s %s while the migration is applied", ref.Kind, ref.Name))
+		}
+		if !lo.Contains(migration.Status.ScaledDownWorkloads, ref) {
+			migration.Status.ScaledDownWorkloads = append(migration.Status.ScaledDownWorkloads, ref)
+		}
+		down = down && running == 0
+	}
+
+	return down, nil
+}
+
+// scaleUpWorkloads scales the workloads scaled down by the migration back up, unless they are to be kept down.
+func (r *MigrationReconciler) scaleUpWorkloads(ctx context.Context, migration *flywayv1alpha1.Migration, keepDown bool) error {
+	var scaledDown []flywayv1alpha1.WorkloadReference
+	for _, ref := range migration.Status.ScaledDownWorkloads {
+		// workloads no longer referenced are released right away
+		if keepDown && lo.Contains(migration.Spec.WorkloadRefs, ref) {
+			scaledDown = append(scaledDown, ref)
+			continue
+		}
+		workload, err := r.getWorkload(ctx, migration.Namespace, ref)
+		if err != nil {
+			return err
+		}
+		if workload == nil {
+			continue
+		}
+
+		original, scaledDownByMigration := workload.GetAnnotations()[replicasAnnotation]
+		if !scaledDownByMigration {
+			continue
+		}
+		count, err := strconv.ParseInt(original, 10, 32)
+		if err != nil {
+			count = 1
+		}
+		replicas, _ := getWorkloadReplicas(workload)
+		patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+		workload.SetAnnotations(lo.OmitByKeys(workload.GetAnnotations(), []string{replicasAnnotation}))
+		*replicas = ptr.To(int32(count))
+		if err := r.GetClient().Patch(ctx, workload, patch); err != nil {
+			return err
+		}
+		r.GetRecorder().Event(migration, corev1.EventTypeNormal, "ScaledUp",
+			fmt.Sprintf("Scaled %s %s back up to %d replicas", ref.Kind, ref.Name, count))
+	}
+	migration.Status.ScaledDownWorkloads = scaledDown
+
+	return nil
+}
+
+// setWorkloadsFinalizer adds, or removes, the finalizer scaling the workloads back up when the migration is deleted.
+// A copy is patched, so that the changes to the status of the migration are kept.
+func (r *MigrationReconciler) setWorkloadsFinalizer(ctx context.Context, migration *flywayv1alpha1.Migration, set bool) error {
+	if controllerutil.ContainsFinalizer(migration, workloadsFinalizer) == set {
+		return nil
+	}
+
+	updated := migration.DeepCopy()
+	if set {
+		controllerutil.AddFinalizer(updated, workloadsFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(updated, workloadsFinalizer)
+	}
+	if err := r.GetClient().Patch(ctx, updated, client.MergeFromWithOptions(migration, client.MergeFromWithOptimisticLock{})); err != nil {
+		return err
+	}
+	migration.Finalizers = updated.Finalizers
+	migration.ResourceVersion = updated.ResourceVersion
+
+	return nil
+}
+
+// finalizeWorkloads scales the workloads scaled down by the deleted migration back up, before letting it go.
+func (r *MigrationReconciler) finalizeWorkloads(ctx context.Context, migration *flywayv1alpha1.Migration) error {
+	if !controllerutil.ContainsFinalizer(migration, workloadsFinalizer) {
+		return nil
+	}
+	if err := r.scaleUpWorkloads(ctx, migration, false); err != nil {
+		return err
+	}
+
+	return r.setWorkloadsFinalizer(ctx, migration, false)
+}
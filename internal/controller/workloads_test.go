@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileWorkloadRefs(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-app", Namespace: "some-namespace"},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To[int32](3)},
+		Status:     appsv1.DeploymentStatus{Replicas: 3},
+	}
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			WorkloadRefs: []flywayv1alpha1.WorkloadReference{{Kind: "Deployment", Name: "some-app"}, {Kind: "StatefulSet", Name: "missing"}},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(deployment, migration)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	// the pods of the workload are still running
+	result, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, workloadRetryInterval, result.RequeueAfter)
+	err = r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), &batchv1.Job{})
+	testhelper.AssertEquals(t, true, err != nil)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(deployment), deployment))
+	testhelper.AssertEquals(t, int32(0), *deployment.Spec.Replicas)
+	testhelper.AssertEquals(t, "3", deployment.Annotations[replicasAnnotation])
+	updated := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertDeepEquals(t, []string{workloadsFinalizer}, updated.Finalizers)
+
+	deployment.Status.Replicas = 0
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, deployment))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	job := &batchv1.Job{}
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(migration), job))
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertDeepEquals(t, migration.Spec.WorkloadRefs[:1], updated.Status.ScaledDownWorkloads)
+
+	job.Status.Succeeded = 1
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	testhelper.AssertNoErr(t, r.GetClient().Status().Update(ctx, job))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(deployment), deployment))
+	testhelper.AssertEquals(t, int32(3), *deployment.Spec.Replicas)
+	_, annotated := deployment.Annotations[replicasAnnotation]
+	testhelper.AssertEquals(t, false, annotated)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, updated))
+	testhelper.AssertEquals(t, true, isReady(updated))
+	testhelper.AssertEquals(t, 0, len(updated.Status.ScaledDownWorkloads))
+	testhelper.AssertEquals(t, 0, len(updated.Finalizers))
+}
+
+func TestReconcileDeletedWithScaledDownWorkloads(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-app", Namespace: "some-namespace"},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To[int32](3)},
+	}
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.MigrationSpec{
+			Database: &flywayv1alpha1.Database{
+				Username: "someUser",
+				JdbcUrl:  "jdbc:postgresql://somehost/somedb",
+			},
+			WorkloadRefs: []flywayv1alpha1.WorkloadReference{{Kind: "Deployment", Name: "some-app"}},
+			MigrationSource: flywayv1alpha1.MigrationSource{
+				ImageRef: "somereg.io/someimage:sometag",
+			},
+		},
+	}
+
+	ctx := context.TODO()
+	r := newTestReconciler(deployment, migration)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}}
+
+	_, err := r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(deployment), deployment))
+	testhelper.AssertEquals(t, int32(0), *deployment.Spec.Replicas)
+
+	// the migration is deleted while its job runs
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, req.NamespacedName, migration))
+	testhelper.AssertNoErr(t, r.GetClient().Delete(ctx, migration))
+	_, err = r.Reconcile(ctx, req)
+	testhelper.AssertNoErr(t, err)
+
+	testhelper.AssertNoErr(t, r.GetClient().Get(ctx, client.ObjectKeyFromObject(deployment), deployment))
+	testhelper.AssertEquals(t, int32(3), *deployment.Spec.Replicas)
+	_, annotated := deployment.Annotations[replicasAnnotation]
+	testhelper.AssertEquals(t, false, annotated)
+	err = r.GetClient().Get(ctx, req.NamespacedName, &flywayv1alpha1.Migration{})
+	testhelper.AssertEquals(t, true, apierrors.IsNotFound(err))
+}
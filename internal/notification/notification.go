@@ -0,0 +1,218 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notification posts notifications of the transitions of migrations to Slack, Microsoft Teams and generic
+// webhooks.
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/samber/lo"
+)
+
+// Notification describes a transition of a migration, it is posted as is to generic webhooks
+type Notification struct {
+	Event            flywayv1alpha1.NotificationEvent `json:"event"`
+	Namespace        string                           `json:"namespace"`
+	Migration        string                           `json:"migration"`
+	Generation       int64                            `json:"generation"`
+	Action           string                           `json:"action"`
+	RequestedVersion string                           `json:"requestedVersion,omitempty"`
+	CurrentVersion   string                           `json:"currentVersion,omitempty"`
+	// Target is the database the job failed on
+	Target string `json:"target,omitempty"`
+	// Message is why the job failed
+	Message string          `json:"message,omitempty"`
+	Targets []TargetVersion `json:"targets,omitempty"`
+	Time    time.Time       `json:"time"`
+}
+
+// TargetVersion is the version a database of the migration is at
+type TargetVersion struct {
+	Name           string `json:"name"`
+	CurrentVersion string `json:"currentVersion,omitempty"`
+}
+
+// Summary returns a line describing the transition.
+func (n *Notification) Summary() string {
+	if n.Event == flywayv1alpha1.NotificationFailed {
+		return fmt.Sprintf("Migration %s/%s failed to %s database %s", n.Namespace, n.Migration, n.Action, n.Target)
+	}
+
+	return fmt.Sprintf("Migration %s/%s succeeded to %s", n.Namespace, n.Migration, n.Action)
+}
+
+type fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// facts returns the details of the transition which are known.
+func (n *Notification) facts() []fact {
+	facts := []fact{
+		{Title: "Migration", Value: fmt.Sprintf("%s/%s", n.Namespace, n.Migration)},
+		{Title: "Generation", Value: fmt.Sprint(n.Generation)},
+		{Title: "Requested version", Value: n.RequestedVersion},
+		{Title: "Current version", Value: n.CurrentVersion},
+		{Title: "Database", Value: n.Target},
+		{Title: "Message", Value: n.Message},
+	}
+	// the version of each database is only told apart when there are several
+	if len(n.Targets) > 1 {
+		for _, target := range n.Targets {
+			facts = append(facts, fact{Title: fmt.Sprintf("Version of %s", target.Name), Value: target.CurrentVersion})
+		}
+	}
+
+	return lo.Filter(facts, func(fact fact, _ int) bool { return fact.Value != "" })
+}
+
+// Notifier sends notifications to receivers
+type Notifier interface {
+	Notify(ctx context.Context, receiverType flywayv1alpha1.ReceiverType, url string, notification *Notification) error
+}
+
+// HTTPNotifier posts notifications to the webhooks of the receivers
+type HTTPNotifier struct {
+	Client *http.Client
+}
+
+// NewHTTPNotifier returns a notifier giving up on receivers not responding within the timeout.
+// Unless private receivers are allowed, it refuses to connect to loopback, link-local and private addresses, which
+// would let the authors of notification policies have the operator post to the services of the cluster, or to the
+// metadata endpoints of cloud providers. The addresses are checked when connecting, which covers redirects, but behind
+// a proxy it is the address of the proxy which is checked.
+func NewHTTPNotifier(timeout time.Duration, allowPrivate bool) *HTTPNotifier {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	return &HTTPNotifier{Client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+// refusePrivateAddress refuses connections to addresses which are not public.
+func refusePrivateAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() ||
+		ip.IsMulticast() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("refusing to notify the private address %s", ip)
+	}
+
+	return nil
+}
+
+// sharedAddressSpace is used by carrier-grade NAT, and by some clusters for their pods and services
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func (h *HTTPNotifier) Notify(ctx context.Context, receiverType flywayv1alpha1.ReceiverType, url string, notification *Notification) error {
+	var payload any
+	switch receiverType {
+	case flywayv1alpha1.ReceiverSlack:
+		payload = slackPayload(notification)
+	case flywayv1alpha1.ReceiverTeams:
+		payload = teamsPayload(notification)
+	case flywayv1alpha1.ReceiverWebhook:
+		payload = notification
+	default:
+		return fmt.Errorf("unknown receiver type %s", receiverType)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if request.URL.Scheme != "https" && request.URL.Scheme != "http" {
+		return fmt.Errorf("unsupported scheme %s of the receiver, only http and https are supported", request.URL.Scheme)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := h.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close() //nolint:errcheck // nothing to do about it
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("%s: %s", response.Status, bytes.TrimSpace(message))
+	}
+
+	return nil
+}
+
+// slackPayload formats the notification as a message to a Slack incoming webhook.
+func slackPayload(notification *Notification) map[string]any {
+	color := "good"
+	if notification.Event == flywayv1alpha1.NotificationFailed {
+		color = "danger"
+	}
+	fields := lo.Map(notification.facts(), func(fact fact, _ int) map[string]any {
+		return map[string]any{"title": fact.Title, "value": fact.Value, "short": fact.Title != "Message"}
+	})
+
+	return map[string]any{
+		"text":        notification.Summary(),
+		"attachments": []map[string]any{{"color": color, "fields": fields, "ts": notification.Time.Unix()}},
+	}
+}
+
+// teamsPayload formats the notification as an adaptive card posted to a Microsoft Teams workflow.
+func teamsPayload(notification *Notification) map[string]any {
+	color := "Good"
+	if notification.Event == flywayv1alpha1.NotificationFailed {
+		color = "Attention"
+	}
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body": []map[string]any{
+					{"type": "TextBlock", "text": notification.Summary(), "weight": "Bolder", "color": color, "wrap": true},
+					{"type": "FactSet", "facts": notification.facts()},
+				},
+			},
+		}},
+	}
+}
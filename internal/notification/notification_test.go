@@ -0,0 +1,107 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+)
+
+func TestNotify(t *testing.T) {
+	var received []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testhelper.AssertEquals(t, "application/json", r.Header.Get("Content-Type"))
+		payload := map[string]any{}
+		testhelper.AssertNoErr(t, json.NewDecoder(r.Body).Decode(&payload))
+		received = append(received, payload)
+	}))
+	defer server.Close()
+
+	notification := &Notification{
+		Event:     flywayv1alpha1.NotificationFailed,
+		Namespace: "some-namespace",
+		Migration: "some-migration",
+		Action:    "migrate",
+		Target:    "tenant-a",
+		Message:   "BackoffLimitExceeded",
+		Time:      time.Now(),
+	}
+	notifier := NewHTTPNotifier(time.Second, true)
+	ctx := context.TODO()
+	for _, receiverType := range []flywayv1alpha1.ReceiverType{flywayv1alpha1.ReceiverSlack, flywayv1alpha1.ReceiverTeams, flywayv1alpha1.ReceiverWebhook} {
+		testhelper.AssertNoErr(t, notifier.Notify(ctx, receiverType, server.URL, notification))
+	}
+
+	summary := "Migration some-namespace/some-migration failed to migrate database tenant-a"
+	testhelper.AssertEquals(t, summary, received[0]["text"])
+	testhelper.AssertEquals(t, "message", received[1]["type"])
+	card := received[1]["attachments"].([]any)[0].(map[string]any)["content"].(map[string]any)
+	testhelper.AssertEquals(t, summary, card["body"].([]any)[0].(map[string]any)["text"])
+	testhelper.AssertEquals(t, "Failed", received[2]["event"])
+	testhelper.AssertEquals(t, "BackoffLimitExceeded", received[2]["message"])
+
+	testhelper.AssertErr(t, notifier.Notify(ctx, "Pager", server.URL, notification))
+}
+
+func TestNotifyRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := NewHTTPNotifier(time.Second, true).Notify(context.TODO(), flywayv1alpha1.ReceiverSlack, server.URL, &Notification{})
+	testhelper.AssertEquals(t, "403 Forbidden: invalid_token", err.Error())
+}
+
+func TestFacts(t *testing.T) {
+	notification := &Notification{
+		Event:          flywayv1alpha1.NotificationSucceeded,
+		Namespace:      "some-namespace",
+		Migration:      "some-migration",
+		Generation:     2,
+		CurrentVersion: "1.1",
+		Targets:        []TargetVersion{{Name: "tenant-a", CurrentVersion: "1.1"}, {Name: "tenant-b", CurrentVersion: "1.2"}},
+	}
+
+	testhelper.AssertDeepEquals(t, []fact{
+		{Title: "Migration", Value: "some-namespace/some-migration"},
+		{Title: "Generation", Value: "2"},
+		{Title: "Current version", Value: "1.1"},
+		{Title: "Version of tenant-a", Value: "1.1"},
+		{Title: "Version of tenant-b", Value: "1.2"},
+	}, notification.facts())
+}
+
+func TestNotifyPrivate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	notifier := NewHTTPNotifier(time.Second, false)
+	ctx := context.TODO()
+	testhelper.AssertErr(t, notifier.Notify(ctx, flywayv1alpha1.ReceiverWebhook, server.URL, &Notification{}))
+	testhelper.AssertErr(t, notifier.Notify(ctx, flywayv1alpha1.ReceiverWebhook, "http://169.254.169.254/latest", &Notification{}))
+	testhelper.AssertErr(t, NewHTTPNotifier(time.Second, true).Notify(ctx, flywayv1alpha1.ReceiverWebhook, "file:///etc/passwd", &Notification{}))
+}
+
+func TestRefusePrivateAddress(t *testing.T) {
+	for address, refused := range map[string]bool{
+		"127.0.0.1:443":        true,
+		"[::1]:443":            true,
+		"10.96.0.1:443":        true,
+		"192.168.1.10:80":      true,
+		"169.254.169.254:80":   true,
+		"100.64.0.10:443":      true,
+		"[::ffff:10.0.0.1]:80": true,
+		"[fd00::1]:443":        true,
+		"0.0.0.0:80":           true,
+		"52.12.34.56:443":      false,
+		"[2a00:1450::1]:443":   false,
+	} {
+		testhelper.AssertEquals(t, refused, refusePrivateAddress("tcp", address, nil) != nil)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements the commands of the kubectl-flyway plugin, which inspects migrations and requests
+// actions from the operator through the annotations it watches.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/davidkarlsen/flyway-operator/internal/controller"
+	"github.com/samber/lo"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// actionRepair is the value of the action annotation requesting a repair
+const actionRepair = "repair"
+
+// Plugin runs the commands against the cluster.
+type Plugin struct {
+	Client client.Client
+	// LogReader reads the logs of jobs, only the logs command uses it
+	LogReader controller.LogReader
+	Out       io.Writer
+}
+
+// Status prints a table of the migrations of the namespace, or of all namespaces when the namespace is empty.
+func (p *Plugin) Status(ctx context.Context, namespace string) error {
+	migrations := &flywayv1alpha1.MigrationList{}
+	if err := p.Client.List(ctx, migrations, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+	if len(migrations.Items) == 0 {
+		_, err := fmt.Fprintln(p.Out, "No migrations found")
+		return err
+	}
+
+	return printStatus(p.Out, migrations.Items, namespace == "", time.Now())
+}
+
+// printStatus prints the versions, pending migrations and last run of the migrations.
+func printStatus(out io.Writer, migrations []flywayv1alpha1.Migration, withNamespace bool, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	header := []string{"NAME", "READY", "PAUSED", "CURRENT", "REQUESTED", "PENDING", "LAST RUN"}
+	if withNamespace {
+		header = append([]string{"NAMESPACE"}, header...)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, migration := range migrations {
+		row := []string{
+			migration.Name,
+			getReady(&migration),
+			strconv.FormatBool(migration.IsPaused()),
+			lo.CoalesceOrEmpty(migration.Status.CurrentVersion, "<none>"),
+			lo.CoalesceOrEmpty(migration.Status.RequestedVersion, "<none>"),
+			strconv.Itoa(lo.SumBy(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus) int { return len(status.PendingMigrations) })),
+			getLastRun(&migration, now),
+		}
+		if withNamespace {
+			row = append([]string{migration.Namespace}, row...)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// getReady returns the status of the Ready condition, Unknown until the migration has been reconciled.
+func getReady(migration *flywayv1alpha1.Migration) string {
+	condition := meta.FindStatusCondition(migration.Status.Conditions, flywayv1alpha1.ConditionReady)
+	if condition == nil {
+		return string(metav1.ConditionUnknown)
+	}
+
+	return string(condition.Status)
+}
+
+// getLastRun describes the most recent run in the history of the migration.
+func getLastRun(migration *flywayv1alpha1.Migration, now time.Time) string {
+	entry, found := lo.Last(migration.Status.History)
+	if !found {
+		return "<none>"
+	}
+
+	return fmt.Sprintf("%s %s (%s ago)", entry.Action, entry.Result, getAge(entry.CompletionTime, now))
+}
+
+// getAge returns how long ago the time was, in the format of kubectl.
+func getAge(t *metav1.Time, now time.Time) string {
+	if t == nil {
+		return "<unknown>"
+	}
+
+	return duration.HumanDuration(now.Sub(t.Time))
+}
+
+// History prints the runs recorded in the status of the migration, oldest first.
+func (p *Plugin) History(ctx context.Context, key types.NamespacedName) error {
+	migration, err := p.getMigration(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(migration.Status.History) == 0 {
+		_, err := fmt.Fprintf(p.Out, "No runs recorded for migration %s\n", key)
+		return err
+	}
+
+	return printHistory(p.Out, migration.Status.History, time.Now())
+}
+
+// printHistory prints a row per run.
+func printHistory(out io.Writer, history []flywayv1alpha1.HistoryEntry, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "COMPLETED\tACTION\tTARGET\tGENERATION\tJOB\tRESULT\tMESSAGE")
+	for _, entry := range history {
+		fmt.Fprintf(w, "%s ago\t%s\t%s\t%d\t%s\t%s\t%s\n", getAge(entry.CompletionTime, now), entry.Action, entry.Target,
+			entry.Generation, entry.JobName, entry.Result, entry.Message)
+	}
+
+	return w.Flush()
+}
+
+// Logs prints the log of the flyway container of the most recent job of the migration,
+// limited to the jobs of the target when it is set.
+func (p *Plugin) Logs(ctx context.Context, key types.NamespacedName, target string) error {
+	migration, err := p.getMigration(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	labels := client.MatchingLabels{"app.kubernetes.io/instance": migration.Name}
+	if target != "" {
+		labels[flywayv1alpha1.TargetName] = target
+	}
+	jobs := &batchv1.JobList{}
+	if err := p.Client.List(ctx, jobs, client.InNamespace(migration.Namespace), labels); err != nil {
+		return err
+	}
+	owned := lo.Filter(jobs.Items, func(job batchv1.Job, _ int) bool { return metav1.IsControlledBy(&job, migration) })
+	if len(owned) == 0 {
+		return fmt.Errorf("no jobs found for migration %s", key)
+	}
+	job := slices.MaxFunc(owned, func(a, b batchv1.Job) int {
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+
+	log, err := p.LogReader.ReadLog(ctx, &job)
+	if err != nil {
+		return fmt.Errorf("unable to read the log of job %s: %w", job.Name, err)
+	}
+	_, err = io.WriteString(p.Out, log)
+	return err
+}
+
+// Pause stops the migration from creating jobs, or resumes it, by the paused annotation.
+func (p *Plugin) Pause(ctx context.Context, key types.NamespacedName, paused bool) error {
+	migration, err := p.getMigration(ctx, key)
+	if err != nil {
+		return err
+	}
+	if migration.IsPaused() == paused {
+		return p.printf("Migration %s is %s\n", key, lo.Ternary(paused, "already paused", "not paused"))
+	}
+
+	if paused {
+		err = p.annotate(ctx, migration, flywayv1alpha1.Paused, strconv.FormatBool(true))
+	} else {
+		err = p.annotate(ctx, migration, flywayv1alpha1.Paused, "")
+	}
+	if err != nil {
+		return err
+	}
+	return p.printf("Migration %s %s\n", key, lo.Ternary(paused, "paused", "resumed"))
+}
+
+// Retry deletes the jobs of the databases whose migration failed, for the operator to run them anew.
+// This also retries a failed rollback, which the operator otherwise retries only once the migration changes.
+func (p *Plugin) Retry(ctx context.Context, key types.NamespacedName) error {
+	migration, err := p.getMigration(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	failed := lo.Filter(migration.Status.Targets, func(status flywayv1alpha1.TargetStatus, _ int) bool {
+		return status.Phase == flywayv1alpha1.TargetFailed
+	})
+	if len(failed) == 0 {
+		return fmt.Errorf("migration %s has no failed databases to retry", key)
+	}
+	for _, status := range failed {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: migration.Namespace, Name: status.JobName}}
+		if err := p.Client.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete job %s: %w", job.Name, err)
+		}
+		if err := p.printf("Retrying database %s of migration %s\n", status.Name, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Repair requests the operator to run flyway repair against all databases of the migration.
+func (p *Plugin) Repair(ctx context.Context, key types.NamespacedName) error {
+	migration, err := p.getMigration(ctx, key)
+	if err != nil {
+		return err
+	}
+	if action := migration.Annotations[flywayv1alpha1.Action]; action != "" {
+		return fmt.Errorf("migration %s is already running %s", key, action)
+	}
+
+	if err := p.annotate(ctx, migration, flywayv1alpha1.Action, actionRepair); err != nil {
+		return err
+	}
+	return p.printf("Repair of migration %s requested\n", key)
+}
+
+// Approve applies the pending migrations awaiting approval.
+func (p *Plugin) Approve(ctx context.Context, key types.NamespacedName) error {
+	migration, err := p.getMigration(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !meta.IsStatusConditionTrue(migration.Status.Conditions, flywayv1alpha1.ConditionPendingApproval) {
+		return fmt.Errorf("migration %s has no pending migrations awaiting approval", key)
+	}
+
+	if err := p.annotate(ctx, migration, flywayv1alpha1.Approve, migration.Status.Approval.Hash); err != nil {
+		return err
+	}
+	for _, status := range migration.Status.Targets {
+		if len(status.PendingMigrations) == 0 {
+			continue
+		}
+		if err := p.printf("Approved migrations of database %s: %s\n", status.Name, strings.Join(status.PendingMigrations, ", ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Plugin) getMigration(ctx context.Context, key types.NamespacedName) (*flywayv1alpha1.Migration, error) {
+	migration := &flywayv1alpha1.Migration{}
+	if err := p.Client.Get(ctx, key, migration); err != nil {
+		return nil, err
+	}
+
+	return migration, nil
+}
+
+// annotate patches the annotation of the migration, an empty value removes it.
+func (p *Plugin) annotate(ctx context.Context, migration *flywayv1alpha1.Migration, key string, value string) error {
+	patch := client.MergeFrom(migration.DeepCopy())
+	if value == "" {
+		delete(migration.Annotations, key)
+	} else {
+		if migration.Annotations == nil {
+			migration.Annotations = map[string]string{}
+		}
+		migration.Annotations[key] = value
+	}
+
+	return p.Client.Patch(ctx, migration, patch)
+}
+
+func (p *Plugin) printf(format string, args ...any) error {
+	_, err := fmt.Fprintf(p.Out, format, args...)
+	return err
+}
@@ -0,0 +1,208 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeLogReader returns the name of the job as its log
+type fakeLogReader struct{}
+
+func (fakeLogReader) ReadLog(_ context.Context, job *batchv1.Job) (string, error) {
+	return "log of " + job.Name, nil
+}
+
+func newTestPlugin(objs ...client.Object) (*Plugin, *bytes.Buffer) {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = flywayv1alpha1.AddToScheme(s)
+	out := &bytes.Buffer{}
+	return &Plugin{
+		Client:    fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+		LogReader: fakeLogReader{},
+		Out:       out,
+	}, out
+}
+
+func newMigration() *flywayv1alpha1.Migration {
+	return &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace", UID: "some-uid"},
+	}
+}
+
+func getMigration(t *testing.T, p *Plugin, key types.NamespacedName) *flywayv1alpha1.Migration {
+	migration := &flywayv1alpha1.Migration{}
+	testhelper.AssertNoErr(t, p.Client.Get(context.TODO(), key, migration))
+	return migration
+}
+
+func TestPrintStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	migration := newMigration()
+	migration.Status = flywayv1alpha1.MigrationStatus{
+		Conditions:       []metav1.Condition{{Type: flywayv1alpha1.ConditionReady, Status: metav1.ConditionTrue}},
+		RequestedVersion: "1.3",
+		CurrentVersion:   "1.2",
+		Targets: []flywayv1alpha1.TargetStatus{
+			{Name: "tenant-a", PendingMigrations: []string{"1.3"}},
+			{Name: "tenant-b", PendingMigrations: []string{"1.3"}},
+		},
+		History: []flywayv1alpha1.HistoryEntry{
+			{Action: "migrate", Result: flywayv1alpha1.TargetSucceeded, CompletionTime: &metav1.Time{Time: now.Add(-5 * time.Minute)}},
+		},
+	}
+	unreconciled := newMigration()
+	unreconciled.Name = "other-migration"
+
+	out := &bytes.Buffer{}
+	testhelper.AssertNoErr(t, printStatus(out, []flywayv1alpha1.Migration{*migration, *unreconciled}, true, now))
+	testhelper.AssertEquals(t, ""+
+		"NAMESPACE        NAME              READY     PAUSED   CURRENT   REQUESTED   PENDING   LAST RUN\n"+
+		"some-namespace   some-migration    True      false    1.2       1.3         2         migrate Succeeded (5m ago)\n"+
+		"some-namespace   other-migration   Unknown   false    <none>    <none>      0         <none>\n", out.String())
+}
+
+func TestPrintHistory(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	history := []flywayv1alpha1.HistoryEntry{
+		{Action: "migrate", Target: "default", JobName: "some-migration", Generation: 1, Result: flywayv1alpha1.TargetFailed,
+			Message: "BackoffLimitExceeded", CompletionTime: &metav1.Time{Time: now.Add(-2 * time.Hour)}},
+		{Action: "repair", Target: "default", JobName: "some-migration-repair", Generation: 1, Result: flywayv1alpha1.TargetSucceeded,
+			CompletionTime: &metav1.Time{Time: now.Add(-90 * time.Second)}},
+	}
+
+	out := &bytes.Buffer{}
+	testhelper.AssertNoErr(t, printHistory(out, history, now))
+	testhelper.AssertEquals(t, ""+
+		"COMPLETED   ACTION    TARGET    GENERATION   JOB                     RESULT      MESSAGE\n"+
+		"120m ago    migrate   default   1            some-migration          Failed      BackoffLimitExceeded\n"+
+		"90s ago     repair    default   1            some-migration-repair   Succeeded   \n", out.String())
+}
+
+func TestPauseAndResume(t *testing.T) {
+	migration := newMigration()
+	p, out := newTestPlugin(migration)
+	key := client.ObjectKeyFromObject(migration)
+
+	testhelper.AssertNoErr(t, p.Pause(context.TODO(), key, true))
+	testhelper.AssertEquals(t, true, getMigration(t, p, key).IsPaused())
+	testhelper.AssertNoErr(t, p.Pause(context.TODO(), key, true))
+
+	testhelper.AssertNoErr(t, p.Pause(context.TODO(), key, false))
+	testhelper.AssertEquals(t, false, getMigration(t, p, key).IsPaused())
+	_, found := getMigration(t, p, key).Annotations[flywayv1alpha1.Paused]
+	testhelper.AssertEquals(t, false, found)
+
+	testhelper.AssertEquals(t, ""+
+		"Migration some-namespace/some-migration paused\n"+
+		"Migration some-namespace/some-migration is already paused\n"+
+		"Migration some-namespace/some-migration resumed\n", out.String())
+}
+
+func TestRetry(t *testing.T) {
+	migration := newMigration()
+	migration.Status.Targets = []flywayv1alpha1.TargetStatus{
+		{Name: "tenant-a", JobName: "some-migration-tenant-a", Phase: flywayv1alpha1.TargetFailed},
+		{Name: "tenant-b", JobName: "some-migration-tenant-b", Phase: flywayv1alpha1.TargetSucceeded},
+	}
+	job := func(name string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: migration.Namespace}}
+	}
+	p, _ := newTestPlugin(migration, job("some-migration-tenant-a"), job("some-migration-tenant-b"))
+	key := client.ObjectKeyFromObject(migration)
+
+	testhelper.AssertNoErr(t, p.Retry(context.TODO(), key))
+
+	err := p.Client.Get(context.TODO(), types.NamespacedName{Namespace: migration.Namespace, Name: "some-migration-tenant-a"}, &batchv1.Job{})
+	testhelper.AssertEquals(t, true, apierrors.IsNotFound(err))
+	testhelper.AssertNoErr(t, p.Client.Get(context.TODO(), types.NamespacedName{Namespace: migration.Namespace, Name: "some-migration-tenant-b"}, &batchv1.Job{}))
+}
+
+func TestRetryWithoutFailures(t *testing.T) {
+	migration := newMigration()
+	p, _ := newTestPlugin(migration)
+
+	testhelper.AssertErr(t, p.Retry(context.TODO(), client.ObjectKeyFromObject(migration)))
+}
+
+func TestRepair(t *testing.T) {
+	migration := newMigration()
+	p, _ := newTestPlugin(migration)
+	key := client.ObjectKeyFromObject(migration)
+
+	testhelper.AssertNoErr(t, p.Repair(context.TODO(), key))
+	testhelper.AssertEquals(t, actionRepair, getMigration(t, p, key).Annotations[flywayv1alpha1.Action])
+	// the repair in progress is not requested again
+	testhelper.AssertErr(t, p.Repair(context.TODO(), key))
+}
+
+func TestApprove(t *testing.T) {
+	migration := newMigration()
+	migration.Status.Approval = &flywayv1alpha1.ApprovalStatus{Hash: "some-hash"}
+	migration.Status.Targets = []flywayv1alpha1.TargetStatus{{Name: "default", PendingMigrations: []string{"1.2", "1.3"}}}
+	p, out := newTestPlugin(migration)
+	key := client.ObjectKeyFromObject(migration)
+
+	// nothing awaits approval until the operator reports it
+	testhelper.AssertErr(t, p.Approve(context.TODO(), key))
+
+	migration = getMigration(t, p, key)
+	migration.Status.Conditions = []metav1.Condition{{Type: flywayv1alpha1.ConditionPendingApproval, Status: metav1.ConditionTrue, Reason: "AwaitingApproval"}}
+	testhelper.AssertNoErr(t, p.Client.Update(context.TODO(), migration))
+
+	testhelper.AssertNoErr(t, p.Approve(context.TODO(), key))
+	testhelper.AssertEquals(t, "some-hash", getMigration(t, p, key).Annotations[flywayv1alpha1.Approve])
+	testhelper.AssertEquals(t, "Approved migrations of database default: 1.2, 1.3\n", out.String())
+}
+
+func TestLogs(t *testing.T) {
+	migration := newMigration()
+	now := time.Now()
+	job := func(name string, target string, created time.Time, owned bool) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         migration.Namespace,
+			CreationTimestamp: metav1.Time{Time: created},
+			Labels:            map[string]string{"app.kubernetes.io/instance": migration.Name, flywayv1alpha1.TargetName: target},
+		}}
+		if owned {
+			job.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: flywayv1alpha1.GroupVersion.String(),
+				Kind:       "Migration",
+				Name:       migration.Name,
+				UID:        migration.UID,
+				Controller: ptr.To(true),
+			}}
+		}
+		return job
+	}
+	p, out := newTestPlugin(migration,
+		job("some-migration-tenant-a", "tenant-a", now.Add(-time.Hour), true),
+		job("some-migration-tenant-b", "tenant-b", now.Add(-time.Minute), true),
+		job("not-owned", "tenant-a", now, false),
+	)
+	key := client.ObjectKeyFromObject(migration)
+
+	testhelper.AssertNoErr(t, p.Logs(context.TODO(), key, ""))
+	testhelper.AssertEquals(t, "log of some-migration-tenant-b", out.String())
+
+	out.Reset()
+	testhelper.AssertNoErr(t, p.Logs(context.TODO(), key, "tenant-a"))
+	testhelper.AssertEquals(t, "log of some-migration-tenant-a", out.String())
+
+	testhelper.AssertErr(t, p.Logs(context.TODO(), key, "tenant-c"))
+}
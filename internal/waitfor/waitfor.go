@@ -0,0 +1,79 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package waitfor blocks until a migration has been applied, it is run by the init container injected into pods
+// which wait for a migration.
+package waitfor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ParseReference parses a reference to a migration, given as name or namespace/name.
+func ParseReference(reference string, namespace string) (types.NamespacedName, error) {
+	name := reference
+	if referencedNamespace, referencedName, found := strings.Cut(reference, "/"); found {
+		namespace, name = referencedNamespace, referencedName
+	}
+	if name == "" || namespace == "" || strings.Contains(name, "/") {
+		return types.NamespacedName{}, fmt.Errorf("invalid migration %q, expected name or namespace/name", reference)
+	}
+
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
+
+// IsReached returns true if the migration has been applied at its current generation, and all databases have reached
+// the version, if any.
+func IsReached(migration *flywayv1alpha1.Migration, version string) bool {
+	if !migration.IsReady() {
+		return false
+	}
+
+	return version == "" || migration.HasReachedVersion(version)
+}
+
+// Wait polls the migration until it has been applied and has reached the version, if any.
+func Wait(ctx context.Context, reader client.Reader, key types.NamespacedName, version string, interval time.Duration) error {
+	logger := log.FromContext(ctx).WithValues("migration", key, "version", version)
+
+	return wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		migration := &flywayv1alpha1.Migration{}
+		if err := reader.Get(ctx, key, migration); err != nil {
+			if apierrors.IsNotFound(err) {
+				logger.Info("Migration not found, waiting")
+				return false, nil
+			}
+			return false, err
+		}
+		if !IsReached(migration, version) {
+			logger.Info("Migration not applied yet, waiting", "currentVersion", migration.Status.CurrentVersion)
+			return false, nil
+		}
+
+		logger.Info("Migration applied", "currentVersion", migration.Status.CurrentVersion)
+		return true, nil
+	})
+}
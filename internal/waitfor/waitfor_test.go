@@ -0,0 +1,65 @@
+package waitfor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseReference(t *testing.T) {
+	key, err := ParseReference("some-migration", "some-namespace")
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, types.NamespacedName{Namespace: "some-namespace", Name: "some-migration"}, key)
+
+	key, err = ParseReference("other-namespace/some-migration", "some-namespace")
+	testhelper.AssertNoErr(t, err)
+	testhelper.AssertEquals(t, types.NamespacedName{Namespace: "other-namespace", Name: "some-migration"}, key)
+
+	_, err = ParseReference("some-migration", "")
+	testhelper.AssertErr(t, err)
+	_, err = ParseReference("some/other/migration", "some-namespace")
+	testhelper.AssertErr(t, err)
+}
+
+func TestIsReached(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Status: flywayv1alpha1.MigrationStatus{
+			Conditions:     []metav1.Condition{{Type: flywayv1alpha1.ConditionReady, Status: metav1.ConditionTrue, ObservedGeneration: 1}},
+			CurrentVersion: "1.10",
+		},
+	}
+	testhelper.AssertEquals(t, false, IsReached(migration, ""))
+
+	migration.Status.Conditions[0].ObservedGeneration = 2
+	testhelper.AssertEquals(t, true, IsReached(migration, ""))
+	testhelper.AssertEquals(t, true, IsReached(migration, "1.9"))
+	testhelper.AssertEquals(t, false, IsReached(migration, "2"))
+}
+
+func TestWait(t *testing.T) {
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Status: flywayv1alpha1.MigrationStatus{
+			Conditions:     []metav1.Condition{{Type: flywayv1alpha1.ConditionReady, Status: metav1.ConditionTrue}},
+			CurrentVersion: "3",
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(flywayv1alpha1.GroupVersion, &flywayv1alpha1.Migration{}, &flywayv1alpha1.MigrationList{})
+	reader := fake.NewClientBuilder().WithScheme(s).WithObjects(migration).Build()
+	key := types.NamespacedName{Namespace: migration.Namespace, Name: migration.Name}
+
+	testhelper.AssertNoErr(t, Wait(context.TODO(), reader, key, "2", time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	testhelper.AssertErr(t, Wait(ctx, reader, key, "4", time.Millisecond))
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/davidkarlsen/flyway-operator/internal/waitfor"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// WaitForContainerName is the name of the init container waiting for a migration
+const WaitForContainerName = "wait-for-migration"
+
+var (
+	podlog        = logf.Log.WithName("pod-resource")
+	versionRegexp = regexp.MustCompile(`^\d+(\.\d+)*$`)
+)
+
+// SetupPodWebhookWithManager registers the webhooks injecting the init container, which runs the image, into pods
+// waiting for a migration, and holding back pods whose schema requirements are not met.
+func SetupPodWebhookWithManager(mgr ctrl.Manager, image string) error {
+	return ctrl.NewWebhookManagedBy(mgr, &corev1.Pod{}).
+		WithDefaulter(&PodCustomDefaulter{Image: image}).
+		WithValidator(&PodCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// Pods are created by controllers the operator does not know of, so failing would block these while the operator is down.
+// The webhook is limited to pods labeled with the key of WaitFor, outside the namespaces of the control plane, by the
+// selectors patched in by config/webhook, as the markers cannot set them.
+//+kubebuilder:webhook:path=/mutate--v1-pod,mutating=true,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=mpod-v1.flyway.davidkarlsen.com,admissionReviewVersions=v1
+
+// PodCustomDefaulter injects an init container into pods annotated with the migration they wait for
+type PodCustomDefaulter struct {
+	// Image is the image of the operator, which runs the init container
+	Image string
+}
+
+// Default implements admission.Defaulter so a webhook will be registered for the type Pod.
+func (d *PodCustomDefaulter) Default(ctx context.Context, pod *corev1.Pod) error {
+	reference, found := pod.Annotations[flywayv1alpha1.WaitFor]
+	if !found || lo.ContainsBy(pod.Spec.InitContainers, func(container corev1.Container) bool {
+		return container.Name == WaitForContainerName
+	}) {
+		return nil
+	}
+
+	// pods created through a controller get their namespace from the request
+	namespace := pod.Namespace
+	if request, err := admission.RequestFromContext(ctx); err == nil && request.Namespace != "" {
+		namespace = request.Namespace
+	}
+	if _, err := waitfor.ParseReference(reference, namespace); err != nil {
+		return err
+	}
+	version := pod.Annotations[flywayv1alpha1.WaitForVersion]
+	if version != "" && !versionRegexp.MatchString(version) {
+		return fmt.Errorf("invalid version %q in annotation %s", version, flywayv1alpha1.WaitForVersion)
+	}
+
+	podlog.Info("Injecting init container waiting for migration", "namespace", namespace, "migration", reference, "version", version)
+	pod.Spec.InitContainers = append([]corev1.Container{d.createWaitForContainer(reference, version)}, pod.Spec.InitContainers...)
+
+	return nil
+}
+
+// createWaitForContainer creates the init container waiting for the migration.
+func (d *PodCustomDefaulter) createWaitForContainer(reference string, version string) corev1.Container {
+	args := []string{fmt.Sprintf("--wait-for=%s", reference)}
+	if version != "" {
+		args = append(args, fmt.Sprintf("--wait-for-version=%s", version))
+	}
+
+	return corev1.Container{
+		Name:    WaitForContainerName,
+		Image:   d.Image,
+		Command: []string{"/manager"},
+		Args:    args,
+		Env: []corev1.EnvVar{{
+			Name:      "POD_NAMESPACE",
+			ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+		}},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: ptr.To(false),
+			RunAsNonRoot:             ptr.To(true),
+			ReadOnlyRootFilesystem:   ptr.To(true),
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		},
+	}
+}
+
+// The webhook is kept out of the namespaces of the control plane by the namespace selector patched in by config/webhook.
+//+kubebuilder:webhook:path=/validate--v1-pod,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=vpod-v1.flyway.davidkarlsen.com,admissionReviewVersions=v1
+
+// PodCustomValidator rejects pods selected by a schema requirement which is not met
+type PodCustomValidator struct {
+	Client client.Reader
+}
+
+// ValidateCreate implements admission.Validator so a webhook will be registered for the type Pod.
+func (v *PodCustomValidator) ValidateCreate(ctx context.Context, pod *corev1.Pod) (admission.Warnings, error) {
+	namespace := pod.Namespace
+	if request, err := admission.RequestFromContext(ctx); err == nil && request.Namespace != "" {
+		namespace = request.Namespace
+	}
+
+	requirements := &flywayv1alpha1.SchemaRequirementList{}
+	if err := v.Client.List(ctx, requirements, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for _, requirement := range requirements.Items {
+		if requirement.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(requirement.Spec.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+
+		// the migration is looked up rather than the status of the requirement, which may lag behind
+		key := requirement.Spec.MigrationRef.GetNamespacedName(requirement.Namespace)
+		migration := &flywayv1alpha1.Migration{}
+		if err := v.Client.Get(ctx, key, migration); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("schema requirement %s is not met: migration %s not found", requirement.Name, key)
+			}
+			return nil, err
+		}
+		if !migration.HasReachedVersion(requirement.Spec.MinVersion) {
+			podlog.Info("Rejecting pod with unmet schema requirement", "namespace", namespace, "requirement", requirement.Name)
+			return nil, fmt.Errorf("schema requirement %s is not met: migration %s is at version %s, %s is required",
+				requirement.Name, key, lo.CoalesceOrEmpty(migration.Status.CurrentVersion, "unknown"), requirement.Spec.MinVersion)
+		}
+	}
+
+	return nil, nil
+}
+
+// ValidateUpdate implements admission.Validator so a webhook will be registered for the type Pod.
+func (v *PodCustomValidator) ValidateUpdate(_ context.Context, _, _ *corev1.Pod) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete implements admission.Validator so a webhook will be registered for the type Pod.
+func (v *PodCustomValidator) ValidateDelete(_ context.Context, _ *corev1.Pod) (admission.Warnings, error) {
+	return nil, nil
+}
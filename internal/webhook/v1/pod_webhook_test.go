@@ -0,0 +1,94 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	flywayv1alpha1 "github.com/davidkarlsen/flyway-operator/api/v1alpha1"
+	"github.com/gophercloud/gophercloud/testhelper"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestDefault(t *testing.T) {
+	defaulter := &PodCustomDefaulter{Image: "ghcr.io/davidkarlsen/flyway-operator:latest"}
+	ctx := admission.NewContextWithRequest(context.TODO(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Namespace: "some-namespace"},
+	})
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				flywayv1alpha1.WaitFor:        "some-migration",
+				flywayv1alpha1.WaitForVersion: "1.2",
+			},
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "some-init"}},
+			Containers:     []corev1.Container{{Name: "some-app"}},
+		},
+	}
+
+	testhelper.AssertNoErr(t, defaulter.Default(ctx, pod))
+	testhelper.AssertEquals(t, 2, len(pod.Spec.InitContainers))
+	container := pod.Spec.InitContainers[0]
+	testhelper.AssertEquals(t, WaitForContainerName, container.Name)
+	testhelper.AssertEquals(t, defaulter.Image, container.Image)
+	testhelper.AssertDeepEquals(t, []string{"--wait-for=some-migration", "--wait-for-version=1.2"}, container.Args)
+
+	// the init container is injected once
+	testhelper.AssertNoErr(t, defaulter.Default(ctx, pod))
+	testhelper.AssertEquals(t, 2, len(pod.Spec.InitContainers))
+}
+
+func TestDefaultInvalid(t *testing.T) {
+	defaulter := &PodCustomDefaulter{Image: "ghcr.io/davidkarlsen/flyway-operator:latest"}
+	ctx := context.TODO()
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "some-namespace"}}
+	testhelper.AssertNoErr(t, defaulter.Default(ctx, pod))
+	testhelper.AssertEquals(t, 0, len(pod.Spec.InitContainers))
+
+	pod.Annotations = map[string]string{flywayv1alpha1.WaitFor: "some/other/migration"}
+	testhelper.AssertErr(t, defaulter.Default(ctx, pod))
+
+	pod.Annotations = map[string]string{flywayv1alpha1.WaitFor: "some-migration", flywayv1alpha1.WaitForVersion: "latest"}
+	testhelper.AssertErr(t, defaulter.Default(ctx, pod))
+}
+
+func TestValidateCreate(t *testing.T) {
+	s := runtime.NewScheme()
+	testhelper.AssertNoErr(t, flywayv1alpha1.AddToScheme(s))
+	migration := &flywayv1alpha1.Migration{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-migration", Namespace: "some-namespace"},
+		Status:     flywayv1alpha1.MigrationStatus{CurrentVersion: "1.9"},
+	}
+	requirement := &flywayv1alpha1.SchemaRequirement{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-app", Namespace: "some-namespace"},
+		Spec: flywayv1alpha1.SchemaRequirementSpec{
+			MigrationRef: flywayv1alpha1.MigrationReference{Name: migration.Name},
+			MinVersion:   "2",
+			Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "some-app"}},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(migration, requirement).Build()
+	validator := &PodCustomValidator{Client: fakeClient}
+	ctx := context.TODO()
+
+	// pods not selected by the requirement are admitted
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "some-namespace", Labels: map[string]string{"app": "other-app"}}}
+	_, err := validator.ValidateCreate(ctx, pod)
+	testhelper.AssertNoErr(t, err)
+
+	pod.Labels["app"] = "some-app"
+	_, err = validator.ValidateCreate(ctx, pod)
+	testhelper.AssertEquals(t, "schema requirement some-app is not met: migration some-namespace/some-migration is at version 1.9, 2 is required", err.Error())
+
+	migration.Status.CurrentVersion = "2"
+	testhelper.AssertNoErr(t, fakeClient.Update(ctx, migration))
+	_, err = validator.ValidateCreate(ctx, pod)
+	testhelper.AssertNoErr(t, err)
+}